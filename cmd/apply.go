@@ -1,114 +1,304 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/yoohya/terracotta/config"
+	"github.com/yoohya/terracotta/report"
 	"github.com/yoohya/terracotta/terraform"
 )
 
-type applyResult struct {
-	Module string
-	Status string // "success", "failed", "skipped"
-	Error  error
-}
+var applyFromPlan string
+var applyOnlyChanged bool
+var applyOnFailure string
+var applyResume string
 
 var applyCmd = &cobra.Command{
 	Use:   "apply",
 	Short: "Apply Terraform modules for a specified environment",
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.LoadConfig(configPath)
-		if err != nil {
-			fmt.Printf("Failed to load config: %v\n", err)
+		started := time.Now()
+		if applyFromPlan != "" && selectionFlagsChanged(cmd) {
+			fmt.Fprintln(out, "--from-plan cannot be combined with module selection flags; the plan already decides which modules run")
 			os.Exit(1)
 		}
-
-		graph, err := config.BuildExecutionGraph(cfg)
-		if err != nil {
-			fmt.Printf("Failed to build execution graph: %v\n", err)
+		if applyResume != "" && (applyFromPlan != "" || selectionFlagsChanged(cmd)) {
+			fmt.Fprintln(out, "--resume cannot be combined with --from-plan or module selection flags; the resumed run already decides which modules run")
 			os.Exit(1)
 		}
 
-		sortedModules, err := graph.TopoSortedModules()
+		cfg, graph, sortedModules, filteredModules := prepareRun()
+		binaries := detectBinaries(context.Background(), sortedModules, cfg.VersionsDir)
+		onFailure, err := parseFailurePolicy(applyOnFailure)
 		if err != nil {
-			fmt.Printf("Failed to resolve module order: %v\n", err)
+			fmt.Fprintln(out, err)
 			os.Exit(1)
 		}
 
-		if awsProfile != "" {
-			if err := os.Setenv("AWS_PROFILE", awsProfile); err != nil {
-				fmt.Printf("Warning: failed to set AWS_PROFILE: %v\n", err)
+		var state *runState
+		if applyResume != "" {
+			state, err = loadRunState(configPath, applyResume)
+			if err != nil {
+				fmt.Fprintf(out, "Failed to read run state: %v\n", err)
+				os.Exit(1)
+			}
+			if err := checkResume(state, cfg, graph); err != nil {
+				fmt.Fprintf(out, "Refusing to resume run %s: %v\n", applyResume, err)
+				os.Exit(1)
+			}
+			if hash, err := hashFile(configPath); err == nil && hash != state.ConfigHash {
+				fmt.Fprintf(out, "Note: %s changed since run %s started, but not in a way that affects the order of its modules\n", configPath, state.RunID)
 			}
+			// A run that applied saved plans goes on applying them.
+			applyFromPlan = state.FromPlan
 		}
 
-		var results []applyResult
+		planFiles := map[string]string{}
+		unchanged := map[string]bool{}
+		if applyFromPlan != "" {
+			manifest, err := readManifest(applyFromPlan)
+			if err != nil {
+				fmt.Fprintf(out, "Failed to read plan manifest: %v\n", err)
+				os.Exit(1)
+			}
+			if err := checkManifest(applyFromPlan, manifest, configPath); err != nil {
+				fmt.Fprintf(out, "Refusing to apply from %s: %v\n", applyFromPlan, err)
+				os.Exit(1)
+			}
+			for _, mod := range manifest.Modules {
+				file, err := filepath.Abs(filepath.Join(applyFromPlan, mod.PlanFile))
+				if err != nil {
+					fmt.Fprintf(out, "Failed to resolve plan file for %s: %v\n", mod.Path, err)
+					os.Exit(1)
+				}
+				planFiles[mod.Path] = file
+				if applyOnlyChanged && !mod.HasChanges {
+					unchanged[mod.Path] = true
+				}
+			}
 
-		for _, mod := range sortedModules {
-			modulePath := filepath.Join(cfg.BasePath, mod.Path)
-			fmt.Printf("[%s] INIT (%s)\n", mod.Path, modulePath)
-			// init コマンドの引数を構築
-			initArgs := []string{"init", "-input=false"}
-			if upgradeProviders {
-				initArgs = append(initArgs, "-upgrade")
-				fmt.Printf("[%s] Provider upgrade enabled\n", mod.Path)
+			// Only the modules in the manifest are applied; the rest were
+			// left out when the plan was created.
+			var planned []*config.ModuleNode
+			for _, mod := range sortedModules {
+				if _, ok := planFiles[mod.Path]; ok {
+					planned = append(planned, mod)
+				} else {
+					filteredModules = append(filteredModules, mod)
+				}
 			}
+			sortedModules = planned
+		}
 
-			if err := terraform.RunCommand(mod.Path, modulePath, initArgs...); err != nil {
-				fmt.Printf("✖ [%s] Terraform init failed!\n", mod.Path)
-				fmt.Printf("    Module path : %s\n", modulePath)
-				cmdStr := "terraform init -input=false"
-				if upgradeProviders {
-					cmdStr += " -upgrade"
+		// A resumed run applies the modules of the earlier run that were not
+		// applied yet. The applied ones are only listed in the report.
+		runModules := sortedModules
+		if state != nil {
+			statuses := state.statuses()
+			runModules = nil
+			var resumed []*config.ModuleNode
+			for _, mod := range sortedModules {
+				switch statuses[mod.Path] {
+				case "":
+					filteredModules = append(filteredModules, mod)
+					continue
+				case stateApplied:
+				default:
+					runModules = append(runModules, mod)
 				}
-				fmt.Printf("    Command     : %s\n", cmdStr)
-				fmt.Printf("    Error       : %v\n", err)
-				results = append(results, applyResult{Module: mod.Path, Status: "failed", Error: fmt.Errorf("init failed: %v", err)})
-				break
+				resumed = append(resumed, mod)
+			}
+			sortedModules = resumed
+			fmt.Fprintf(out, "Resuming run %s\n", state.RunID)
+		} else {
+			state, err = newRunState(configPath, cfg, sortedModules)
+			if err == nil {
+				state.FromPlan = applyFromPlan
+				err = state.save()
 			}
+			if err != nil {
+				fmt.Fprintf(out, "Warning: failed to save run state, this run cannot be resumed: %v\n", err)
+				state = nil
+			} else {
+				fmt.Fprintf(out, "Run ID: %s\n", state.RunID)
+			}
+		}
 
-			fmt.Printf("[%s] APPLY (%s)\n", mod.Path, modulePath)
-			if err := terraform.RunCommand(mod.Path, modulePath, "apply", "-auto-approve"); err != nil {
-				fmt.Printf("✖ [%s] Terraform apply failed!\n", mod.Path)
-				fmt.Printf("    Module path : %s\n", modulePath)
-				fmt.Printf("    Command     : terraform apply -auto-approve\n")
-				fmt.Printf("    Error       : %v\n", err)
-				results = append(results, applyResult{Module: mod.Path, Status: "failed", Error: fmt.Errorf("apply failed: %v", err)})
-				break
+		// With --only-changed, each module is planned into a temporary plan
+		// file first and applied from it only if it has changes.
+		var tmpDir string
+		if applyOnlyChanged && applyFromPlan == "" {
+			dir, err := os.MkdirTemp("", "terracotta-plan-")
+			if err != nil {
+				fmt.Fprintf(out, "Failed to create plan directory: %v\n", err)
+				os.Exit(1)
+			}
+			tmpDir = dir
+		}
+
+		ctx, cancel := runContext()
+		defer cancel()
+		applyModule := applyTask(cfg.BasePath, planFiles, unchanged, tmpDir)
+		runs := runGraph(ctx, runModules, parallelism, onFailure, func(ctx context.Context, run *moduleRun) error {
+			err := applyModule(ctx, run)
+			if state != nil {
+				status := stateApplied
+				if err != nil {
+					status = stateFailed
+				}
+				if serr := state.record(run.Module.Path, status); serr != nil {
+					fmt.Fprintf(run.Out, "[%s] Warning: failed to save run state: %v\n", run.Module.Path, serr)
+				}
+			}
+			return err
+		})
+		if state != nil {
+			statuses := state.statuses()
+			for _, mod := range sortedModules {
+				if statuses[mod.Path] == stateApplied && runs[mod.Path] == nil {
+					runs[mod.Path] = &moduleRun{Module: mod, Status: report.StatusAlreadyApplied}
+				}
 			}
+		}
 
-			results = append(results, applyResult{Module: mod.Path, Status: "success"})
+		if tmpDir != "" {
+			_ = os.RemoveAll(tmpDir)
 		}
 
-		fmt.Println("\nApply Summary:")
-		encounteredFailure := false
-		executed := map[string]bool{}
-		for _, res := range results {
-			executed[res.Module] = true
+		rep := buildReport(ctx, "apply", started, sortedModules, runs, filteredModules)
+		rep.Binaries = reportBinaries(binaries)
+		if state != nil {
+			rep.RunID = state.RunID
+		}
+		fmt.Fprintln(out, "\nApply Summary:")
+		printBinaries(binaries)
+		for _, res := range rep.Modules {
 			switch res.Status {
-			case "success":
-				fmt.Printf("✔ %s: applied successfully\n", res.Module)
-			case "failed":
-				fmt.Printf("✖ %s: failed - %v\n", res.Module, res.Error)
-				encounteredFailure = true
+			case report.StatusSuccess:
+				fmt.Fprintf(out, "✔ %s: applied successfully\n", res.Path)
+			case report.StatusUnchanged:
+				fmt.Fprintf(out, "✔ %s: no changes, apply skipped\n", res.Path)
+			case report.StatusAlreadyApplied:
+				fmt.Fprintf(out, "✔ %s: already applied in run %s\n", res.Path, state.RunID)
+			case report.StatusFailed:
+				fmt.Fprintf(out, "✖ %s: failed - %s\n", res.Path, res.Error)
+			case report.StatusInterrupted:
+				fmt.Fprintf(out, "⏹ %s: interrupted\n", res.Path)
+			case report.StatusTimedOut:
+				fmt.Fprintf(out, "⏱ %s: timed out - %s\n", res.Path, res.Error)
+			case report.StatusSkipped:
+				fmt.Fprintf(out, "⏭ %s: skipped%s\n", res.Path, blockedNote(res))
 			}
+			printModuleDetails(res)
 		}
-		for _, mod := range sortedModules {
-			if !executed[mod.Path] {
-				fmt.Printf("⏭ %s: skipped\n", mod.Path)
+		printFiltered(filteredModules)
+		if state != nil && rep.Status != report.StatusSuccess {
+			resume := "terracotta apply --resume " + state.RunID
+			if cmd.Flags().Changed("config") {
+				resume += " --config " + configPath
 			}
+			fmt.Fprintf(out, "\nResume with: %s\n", resume)
 		}
-		if encounteredFailure {
+
+		writeReports(rep)
+		if rep.Status == report.StatusInterrupted {
+			os.Exit(exitInterrupted)
+		}
+		if rep.Failed() {
 			os.Exit(1)
 		}
 	},
 }
 
+// applyTask returns the task that applies a module of basePath. A module
+// with a file in planFiles is applied from that saved plan, one in unchanged
+// is skipped, and with planDir set each module is planned into planDir first
+// and applied only if it has changes.
+func applyTask(basePath string, planFiles map[string]string, unchanged map[string]bool, planDir string) moduleTask {
+	return func(ctx context.Context, run *moduleRun) error {
+		mod, w := run.Module, run.Out
+		if unchanged[mod.Path] {
+			fmt.Fprintf(w, "[%s] No changes in saved plan, skipping apply\n", mod.Path)
+			run.Status = report.StatusUnchanged
+			return nil
+		}
+
+		modulePath := filepath.Join(basePath, mod.Path)
+		fmt.Fprintf(w, "[%s] INIT (%s)\n", mod.Path, modulePath)
+		if upgradeProviders {
+			fmt.Fprintf(w, "[%s] Provider upgrade enabled\n", mod.Path)
+		}
+
+		if err := run.run(ctx, modulePath, initArgs()...); err != nil {
+			fmt.Fprintf(w, "✖ [%s] Terraform init failed!\n", mod.Path)
+			fmt.Fprintf(w, "    Module path : %s\n", modulePath)
+			fmt.Fprintf(w, "    Command     : %s\n", commandLine(mod.Binary, initArgs()))
+			fmt.Fprintf(w, "    Error       : %v\n", err)
+			return fmt.Errorf("init failed: %v", err)
+		}
+
+		planFile := planFiles[mod.Path]
+		if planDir != "" {
+			file, err := planFilePath(planDir, mod.Path)
+			if err == nil {
+				err = os.MkdirAll(filepath.Dir(file), 0755)
+			}
+			if err != nil {
+				fmt.Fprintf(w, "[%s] Error preparing plan file: %v\n", mod.Path, err)
+				return fmt.Errorf("plan failed: %v", err)
+			}
+
+			fmt.Fprintf(w, "[%s] PLAN (%s)\n", mod.Path, modulePath)
+			changes, err := terraform.PlanChanges(run.run(ctx, modulePath, planArgs(file)...))
+			if err != nil {
+				fmt.Fprintf(w, "✖ [%s] Terraform plan failed!\n", mod.Path)
+				fmt.Fprintf(w, "    Module path : %s\n", modulePath)
+				fmt.Fprintf(w, "    Command     : %s\n", commandLine(mod.Binary, planArgs(file)))
+				fmt.Fprintf(w, "    Error       : %v\n", err)
+				return fmt.Errorf("plan failed: %v", err)
+			}
+			if !changes {
+				fmt.Fprintf(w, "[%s] No changes, skipping apply\n", mod.Path)
+				run.Status = report.StatusUnchanged
+				return nil
+			}
+			planFile = file
+		}
+
+		fmt.Fprintf(w, "[%s] APPLY (%s)\n", mod.Path, modulePath)
+		if err := run.run(ctx, modulePath, applyArgs(planFile)...); err != nil {
+			fmt.Fprintf(w, "✖ [%s] Terraform apply failed!\n", mod.Path)
+			fmt.Fprintf(w, "    Module path : %s\n", modulePath)
+			fmt.Fprintf(w, "    Command     : %s\n", commandLine(mod.Binary, applyArgs(planFile)))
+			fmt.Fprintf(w, "    Error       : %v\n", err)
+			return fmt.Errorf("apply failed: %v", err)
+		}
+
+		return nil
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(applyCmd)
 	applyCmd.Flags().StringVarP(&configPath, "config", "c", "terracotta.yaml", "Path to config file")
 	applyCmd.Flags().StringVar(&awsProfile, "profile", "", "AWS profile to use")
+	applyCmd.Flags().StringVar(&binaryOverride, "binary", "", "Binary to run instead of the config's binary, such as tofu; modules with their own binary keep it")
+	applyCmd.Flags().StringVar(&versionsDirOverride, "versions-dir", "", "Directory of installed binaries as <version>/<binary> to pick from when a module needs another version")
+	applyCmd.Flags().StringVar(&dockerImage, "docker-image", "", "Run every step in a container from this image instead of with a local binary")
 	applyCmd.Flags().BoolVar(&upgradeProviders, "upgrade", false, "Upgrade providers to the latest version")
+	addSelectionFlags(applyCmd)
+	applyCmd.Flags().StringVar(&applyFromPlan, "from-plan", "", "Apply the plan files saved by plan --out-dir in this directory")
+	applyCmd.Flags().BoolVar(&applyOnlyChanged, "only-changed", false, "Plan each module first and skip apply when it has no changes")
+	applyCmd.Flags().StringVar(&applyResume, "resume", "", "Resume the apply run with this run ID, skipping the modules it already applied")
+	applyCmd.Flags().StringVar(&applyOnFailure, "on-failure", string(failureStop), "What to do when a module fails: stop, continue or skip-dependents")
+	addReportFlags(applyCmd)
+	applyCmd.Flags().DurationVar(&runTimeout, "timeout", 0, "Maximum duration of the whole run, e.g. 2h; running modules are interrupted and reported as timed out")
+	applyCmd.Flags().StringVar(&logDir, "log-dir", "", "Also write the output of every terraform step to <log-dir>/<module path>/<step>.log")
+	applyCmd.Flags().IntVar(&parallelism, "parallelism", 1, "Maximum number of modules to run concurrently")
+	applyCmd.Flags().BoolVar(&groupOutput, "group-output", false, "With --parallelism, print the output of each module as one block when it finishes instead of line by line")
 }
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yoohya/terracotta/report"
+	"github.com/yoohya/terracotta/terraform"
+)
+
+func TestApplyTask(t *testing.T) {
+	tests := []struct {
+		name      string
+		onFailure failurePolicy
+		planned   bool
+		want      map[string]string
+		wantSteps []string
+	}{
+		{
+			name:      "stop on failure",
+			onFailure: failureStop,
+			want: map[string]string{
+				"network": report.StatusSuccess,
+				"a":       report.StatusFailed,
+			},
+			wantSteps: []string{
+				"envs/dev/network init",
+				"envs/dev/network apply",
+				"envs/dev/a init",
+				"envs/dev/a apply",
+			},
+		},
+		{
+			name:      "continue on failure",
+			onFailure: failureContinue,
+			want: map[string]string{
+				"network":    report.StatusSuccess,
+				"a":          report.StatusFailed,
+				"b":          report.StatusSuccess,
+				"c":          report.StatusSuccess,
+				"monitoring": report.StatusSuccess,
+			},
+			wantSteps: []string{
+				"envs/dev/network init",
+				"envs/dev/network apply",
+				"envs/dev/a init",
+				"envs/dev/a apply",
+				"envs/dev/b init",
+				"envs/dev/b apply",
+				"envs/dev/c init",
+				"envs/dev/c apply",
+				"envs/dev/monitoring init",
+				"envs/dev/monitoring apply",
+			},
+		},
+		{
+			name:      "only changed",
+			onFailure: failureSkipDependents,
+			planned:   true,
+			want: map[string]string{
+				"network":    report.StatusUnchanged,
+				"a":          report.StatusFailed,
+				"b":          report.StatusSuccess,
+				"c":          report.StatusUnchanged,
+				"monitoring": report.StatusSkipped,
+			},
+			wantSteps: []string{
+				"envs/dev/network init",
+				"envs/dev/network plan",
+				"envs/dev/a init",
+				"envs/dev/a plan",
+				"envs/dev/a apply",
+				"envs/dev/b init",
+				"envs/dev/b plan",
+				"envs/dev/b apply",
+				"envs/dev/c init",
+				"envs/dev/c plan",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFakeRunner(t)
+			fake.On("a", "plan", terraform.FakeResponse{ExitCode: 2})
+			fake.On("b", "plan", terraform.FakeResponse{ExitCode: 2})
+			fake.On("a", "apply", terraform.FakeResponse{Stderr: "Error: creating bucket\n", ExitCode: 1})
+
+			planDir := ""
+			if tt.planned {
+				planDir = t.TempDir()
+			}
+			results := runGraph(context.Background(), testModules(), 1, tt.onFailure, applyTask("envs/dev", nil, nil, planDir))
+
+			got := map[string]string{}
+			for path, run := range results {
+				got[path] = moduleStatus(run)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("statuses mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantSteps, fakeSteps(fake)); diff != "" {
+				t.Errorf("calls mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestApplyTaskFromPlan(t *testing.T) {
+	fake := useFakeRunner(t)
+	planFiles := map[string]string{"network": "/plans/network/tfplan", "a": "/plans/a/tfplan"}
+	unchanged := map[string]bool{"a": true}
+
+	modules := testModules()[:2]
+	results := runGraph(context.Background(), modules, 1, failureStop, applyTask("envs/dev", planFiles, unchanged, ""))
+
+	if got := moduleStatus(results["a"]); got != report.StatusUnchanged {
+		t.Errorf("expected a to be %s, got %s", report.StatusUnchanged, got)
+	}
+	calls := fake.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected init and apply of network only, got %v", fakeSteps(fake))
+	}
+	if diff := cmp.Diff([]string{"apply", "-input=false", "/plans/network/tfplan"}, calls[1].Args); diff != "" {
+		t.Errorf("apply args mismatch (-want +got):\n%s", diff)
+	}
+}
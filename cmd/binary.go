@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yoohya/terracotta/config"
+	"github.com/yoohya/terracotta/report"
+	"github.com/yoohya/terracotta/terraform"
+)
+
+// binaryOverride replaces the binary set at the top level of the config.
+// Modules with their own binary keep it.
+var binaryOverride string
+
+// versionsDirOverride replaces the versions_dir of the config.
+var versionsDirOverride string
+
+// detectBinaries resolves the binary of every module with resolveBinaries.
+// Any problem is printed and ends the process before any module starts.
+func detectBinaries(ctx context.Context, modules []*config.ModuleNode, versionsDir string) []terraform.BinaryInfo {
+	infos, problems := resolveBinaries(ctx, modules, versionsDir)
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintln(out, p)
+		}
+		os.Exit(1)
+	}
+	return infos
+}
+
+// resolveBinaries detects the flavor and version of every binary the
+// modules run and returns them in the order the modules first use them.
+// A module whose binary does not satisfy its version constraint is switched
+// to the newest matching binary in versionsDir, if there is one. It returns
+// a message for each binary that cannot be run and each module left
+// without a matching binary.
+func resolveBinaries(ctx context.Context, modules []*config.ModuleNode, versionsDir string) ([]terraform.BinaryInfo, []string) {
+	type detected struct {
+		info terraform.BinaryInfo
+		err  error
+	}
+	cache := map[string]detected{}
+	detect := func(binary string) (terraform.BinaryInfo, error) {
+		d, ok := cache[binary]
+		if !ok {
+			d.info, d.err = terraform.DetectBinary(ctx, runner, binary)
+			cache[binary] = d
+		}
+		return d.info, d.err
+	}
+
+	var infos []terraform.BinaryInfo
+	var problems []string
+	seen := map[string]bool{}
+	for _, mod := range modules {
+		info, err := detect(mod.Binary)
+		if mod.RequiredVersion != "" {
+			constraint, cerr := config.ParseVersionConstraint(mod.RequiredVersion)
+			if cerr != nil {
+				problems = append(problems, fmt.Sprintf("Module %s: %v", mod.Path, cerr))
+				continue
+			}
+			if err != nil || !allowsBinary(constraint, info) {
+				if path := findInstalled(versionsDir, mod.Binary, constraint); path != "" {
+					mod.Binary = path
+					info, err = detect(path)
+				}
+			}
+			if err == nil && !allowsBinary(constraint, info) {
+				if info.Version == "" {
+					problems = append(problems, fmt.Sprintf("Module %s requires version %s, but the version of %s is unknown", mod.Path, mod.RequiredVersion, mod.Binary))
+				} else {
+					problems = append(problems, fmt.Sprintf("Module %s requires version %s, but %s is %s", mod.Path, mod.RequiredVersion, mod.Binary, info))
+				}
+				continue
+			}
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Failed to run %s for module %s: %v", mod.Binary, mod.Path, err))
+			continue
+		}
+		if !seen[mod.Binary] {
+			seen[mod.Binary] = true
+			infos = append(infos, info)
+		}
+	}
+	return infos, problems
+}
+
+// allowsBinary reports whether the version of info satisfies constraint.
+// A binary whose version is unknown satisfies no constraint.
+func allowsBinary(constraint config.VersionConstraint, info terraform.BinaryInfo) bool {
+	v, err := config.ParseVersion(info.Version)
+	return err == nil && constraint.Allows(v)
+}
+
+// findInstalled returns the newest binary in versionsDir that satisfies
+// constraint and has the same name as binary, or "" if there is none.
+// Binaries are looked up as <versionsDir>/<version>/<name>, the layout of
+// tfenv and tofuenv.
+func findInstalled(versionsDir, binary string, constraint config.VersionConstraint) string {
+	if versionsDir == "" {
+		return ""
+	}
+	entries, err := os.ReadDir(versionsDir)
+	if err != nil {
+		return ""
+	}
+
+	var best config.Version
+	var bestPath string
+	for _, entry := range entries {
+		v, err := config.ParseVersion(entry.Name())
+		if err != nil || !constraint.Allows(v) || (bestPath != "" && v.Compare(best) <= 0) {
+			continue
+		}
+		path := filepath.Join(versionsDir, entry.Name(), filepath.Base(binary))
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		best, bestPath = v, path
+	}
+	return bestPath
+}
+
+// formatBinaries formats binaries as "tofu (OpenTofu v1.8.0), terraform
+// (Terraform v1.9.5)".
+func formatBinaries(binaries []terraform.BinaryInfo) string {
+	parts := make([]string, len(binaries))
+	for i, b := range binaries {
+		parts[i] = fmt.Sprintf("%s (%s)", b.Binary, b)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printBinaries prints the binaries a run used, as the first line of its
+// summary.
+func printBinaries(binaries []terraform.BinaryInfo) {
+	switch len(binaries) {
+	case 0:
+	case 1:
+		fmt.Fprintf(out, "Binary: %s\n", formatBinaries(binaries))
+	default:
+		fmt.Fprintf(out, "Binaries: %s\n", formatBinaries(binaries))
+	}
+}
+
+func reportBinaries(binaries []terraform.BinaryInfo) []report.Binary {
+	var r []report.Binary
+	for _, b := range binaries {
+		r = append(r, report.Binary{Binary: b.Binary, Flavor: b.Flavor, Version: b.Version})
+	}
+	return r
+}
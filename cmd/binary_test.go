@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yoohya/terracotta/config"
+	"github.com/yoohya/terracotta/terraform"
+)
+
+func TestResolveBinaries(t *testing.T) {
+	fake := useFakeRunner(t)
+	// Binaries are detected in the order the modules first use them, each
+	// with version -json and then version.
+	for _, v := range []struct{ json, plain string }{
+		{`{"terraform_version": "1.9.5"}`, "Terraform v1.9.5\n"},
+		{`{"terraform_version": "1.5.7"}`, "Terraform v1.5.7\n"},
+		{`{"terraform_version": "1.8.0"}`, "OpenTofu v1.8.0\n"},
+	} {
+		fake.On("", "version", terraform.FakeResponse{Stdout: v.json, Times: 1})
+		fake.On("", "version", terraform.FakeResponse{Stdout: v.plain, Times: 1})
+	}
+
+	versionsDir := t.TempDir()
+	for _, file := range []string{"1.5.5/terraform", "1.5.7/terraform", "1.6.0/terraform", "1.8.1/tofu", "latest/terraform"} {
+		writeFile(t, filepath.Join(versionsDir, file), "")
+	}
+
+	modules := []*config.ModuleNode{
+		{Path: "network", Binary: "terraform"},
+		{Path: "legacy", Binary: "terraform", RequiredVersion: "~> 1.5.0"},
+		{Path: "app", Binary: "terraform", RequiredVersion: ">= 1.9"},
+		{Path: "old", Binary: "terraform", RequiredVersion: "~> 1.4.0"},
+		{Path: "dns", Binary: "tofu", RequiredVersion: ">= 1.8"},
+	}
+	binaries, problems := resolveBinaries(context.Background(), modules, versionsDir)
+
+	installed := filepath.Join(versionsDir, "1.5.7", "terraform")
+	want := []terraform.BinaryInfo{
+		{Binary: "terraform", Flavor: terraform.FlavorTerraform, Version: "1.9.5"},
+		{Binary: installed, Flavor: terraform.FlavorTerraform, Version: "1.5.7"},
+		{Binary: "tofu", Flavor: terraform.FlavorOpenTofu, Version: "1.8.0"},
+	}
+	if diff := cmp.Diff(want, binaries); diff != "" {
+		t.Errorf("binaries mismatch (-want +got):\n%s", diff)
+	}
+	if modules[1].Binary != installed {
+		t.Errorf("expected legacy to run %s, got %s", installed, modules[1].Binary)
+	}
+	wantProblems := []string{"Module old requires version ~> 1.4.0, but terraform is Terraform v1.9.5"}
+	if diff := cmp.Diff(wantProblems, problems); diff != "" {
+		t.Errorf("problems mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := formatBinaries(binaries[:1]), "terraform (Terraform v1.9.5)"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestModuleRunUsesModuleBinary(t *testing.T) {
+	fake := useFakeRunner(t)
+	modules := []*config.ModuleNode{{Path: "network", Binary: "tofu"}, {Path: "app"}}
+
+	results := runGraph(context.Background(), modules, 1, failureStop, applyTask("envs/dev", nil, nil, ""))
+
+	var commands []string
+	for _, c := range fake.Calls() {
+		commands = append(commands, c.Command+" "+c.Step())
+	}
+	want := []string{"tofu init", "tofu apply", "terraform init", "terraform apply"}
+	if diff := cmp.Diff(want, commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	if got := results["network"].Commands[0]; got != "tofu init -input=false" {
+		t.Errorf("expected the recorded command to name tofu, got %q", got)
+	}
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yoohya/terracotta/config"
+)
+
+var changedSince string
+
+// changedModules returns the modules affected by git changes since ref: the
+// modules containing changed files, the modules whose definition changed in
+// the config file at cfgPath, and every module downstream of them. Changes
+// are taken from the merge base of ref and HEAD, and include uncommitted and
+// untracked files.
+func changedModules(cfg *config.Config, graph *config.ExecutionGraph, cfgPath, ref string) (map[string]bool, error) {
+	base, err := git("merge-base", ref, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	root = config.ResolvePath(root)
+	diff, err := gitFiles("diff", "--name-only", "-z", base)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := gitFiles("ls-files", "--others", "--exclude-standard", "--full-name", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	// git reports paths relative to the repository root.
+	var files []string
+	for _, name := range append(diff, untracked...) {
+		files = append(files, filepath.Join(root, filepath.FromSlash(name)))
+	}
+
+	changed := cfg.ModulesForFiles(files)
+
+	cfgAbs := config.ResolvePath(cfgPath)
+	cfgFile, err := filepath.Rel(root, cfgAbs)
+	if err != nil {
+		return nil, err
+	}
+	cfgChanged := false
+	for _, file := range files {
+		if config.ResolvePath(file) == cfgAbs {
+			cfgChanged = true
+		}
+	}
+	if cfgChanged {
+		old, err := configAt(base, filepath.ToSlash(cfgFile))
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, cfg.ChangedModules(old)...)
+	}
+
+	result := make(map[string]bool)
+	for _, path := range changed {
+		result[path] = true
+	}
+	for _, path := range graph.Dependents(changed...) {
+		result[path] = true
+	}
+	return result, nil
+}
+
+// configAt loads the config file at path as of revision rev. It returns nil
+// if the file did not exist then.
+func configAt(rev, path string) (*config.Config, error) {
+	if _, err := git("cat-file", "-e", rev+":"+path); err != nil {
+		return nil, nil
+	}
+	data, err := git("show", rev+":"+path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config.Config
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s at %s: %w", path, rev, err)
+	}
+	return &cfg, nil
+}
+
+// git runs a git command in the working directory and returns its trimmed
+// standard output.
+func git(args ...string) (string, error) {
+	output, err := gitOutput(args...)
+	return strings.TrimSpace(output), err
+}
+
+// gitFiles runs a git command that lists files separated by NUL bytes, as
+// with -z, and returns the file names. Unlike the default output, names with
+// unusual characters are not quoted.
+func gitFiles(args ...string) ([]string, error) {
+	output, err := gitOutput(args...)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(output, "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func gitOutput(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yoohya/terracotta/config"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func runGit(t *testing.T, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+}
+
+func TestChangedModules(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found in PATH")
+	}
+
+	repo := t.TempDir()
+	t.Chdir(repo)
+
+	writeFile(t, "infra/terracotta.yaml", `base_path: envs/dev
+modules:
+  - path: network
+  - path: db
+    depends_on: [network]
+  - path: api
+    depends_on: [db]
+  - path: dns
+`)
+	for _, mod := range []string{"network", "db", "api", "dns"} {
+		writeFile(t, filepath.Join("infra/envs/dev", mod, "main.tf"), "")
+	}
+	runGit(t, "init", "-q")
+	runGit(t, "add", "-A")
+	runGit(t, "commit", "-q", "-m", "initial")
+
+	// Run from a subdirectory of the repository to check path mapping.
+	t.Chdir("infra")
+
+	writeFile(t, "envs/dev/db/variables.tf", "")
+	writeFile(t, "terracotta.yaml", `base_path: envs/dev
+modules:
+  - path: network
+  - path: db
+    depends_on: [network]
+  - path: api
+    depends_on: [db]
+  - path: dns
+  - path: cdn
+    depends_on: [dns]
+`)
+	writeFile(t, "envs/dev/cdn/main.tf", "")
+	// git quotes names like this one unless asked for raw output.
+	writeFile(t, "envs/dev/dns/zöne.tf", "")
+
+	cfg, err := config.LoadConfig("terracotta.yaml")
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	graph, err := config.BuildExecutionGraph(cfg)
+	if err != nil {
+		t.Fatalf("failed to build graph: %v", err)
+	}
+
+	changed, err := changedModules(cfg, graph, "terracotta.yaml", "HEAD")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for path := range changed {
+		got = append(got, path)
+	}
+	sort.Strings(got)
+	want := []string{"api", "cdn", "db", "dns"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("changedModules() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yoohya/terracotta/config"
+	"github.com/yoohya/terracotta/report"
+)
+
+var destroyConfirm string
+
+var destroyCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Destroy Terraform modules in reverse dependency order",
+	Long: `Destroy runs terraform destroy for every selected module, destroying modules
+that depend on others before the modules they depend on.
+
+Before anything is destroyed, the environment name (the last element of
+base_path) must be typed to confirm, or passed with --confirm.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		started := time.Now()
+		cfg, _, sortedModules, filteredModules := prepareRun()
+		binaries := detectBinaries(context.Background(), sortedModules, cfg.VersionsDir)
+		modules := reverseModules(sortedModules)
+		environment := filepath.Base(filepath.Clean(cfg.BasePath))
+
+		fmt.Fprintf(out, "The following modules in %s will be destroyed, in this order:\n", environment)
+		for _, mod := range modules {
+			fmt.Fprintf(out, "- %s\n", mod.Path)
+		}
+		warnRemainingDependents(sortedModules, filteredModules)
+
+		if !confirmDestroy(environment, os.Stdin) {
+			fmt.Fprintln(out, "Destroy cancelled.")
+			os.Exit(1)
+		}
+
+		ctx, cancel := runContext()
+		defer cancel()
+		runs := runGraph(ctx, modules, parallelism, failureStop, destroyTask(cfg.BasePath))
+
+		rep := buildReport(ctx, "destroy", started, modules, runs, filteredModules)
+		rep.Binaries = reportBinaries(binaries)
+		fmt.Fprintln(out, "\nDestroy Summary:")
+		printBinaries(binaries)
+		for _, res := range rep.Modules {
+			switch res.Status {
+			case report.StatusSuccess:
+				fmt.Fprintf(out, "✔ %s: destroyed successfully\n", res.Path)
+			case report.StatusFailed:
+				fmt.Fprintf(out, "✖ %s: failed - %s\n", res.Path, res.Error)
+			case report.StatusInterrupted:
+				fmt.Fprintf(out, "⏹ %s: interrupted\n", res.Path)
+			case report.StatusTimedOut:
+				fmt.Fprintf(out, "⏱ %s: timed out - %s\n", res.Path, res.Error)
+			case report.StatusSkipped:
+				fmt.Fprintf(out, "⏭ %s: skipped%s\n", res.Path, blockedNote(res))
+			}
+			printModuleDetails(res)
+		}
+		printFiltered(filteredModules)
+
+		writeReports(rep)
+		if rep.Status == report.StatusInterrupted {
+			os.Exit(exitInterrupted)
+		}
+		if rep.Failed() {
+			os.Exit(1)
+		}
+	},
+}
+
+// destroyTask returns the task that destroys a module of basePath.
+func destroyTask(basePath string) moduleTask {
+	return func(ctx context.Context, run *moduleRun) error {
+		mod, w := run.Module, run.Out
+		modulePath := filepath.Join(basePath, mod.Path)
+		fmt.Fprintf(w, "[%s] INIT (%s)\n", mod.Path, modulePath)
+		if upgradeProviders {
+			fmt.Fprintf(w, "[%s] Provider upgrade enabled\n", mod.Path)
+		}
+
+		if err := run.run(ctx, modulePath, initArgs()...); err != nil {
+			fmt.Fprintf(w, "✖ [%s] Terraform init failed!\n", mod.Path)
+			fmt.Fprintf(w, "    Module path : %s\n", modulePath)
+			fmt.Fprintf(w, "    Command     : %s\n", commandLine(mod.Binary, initArgs()))
+			fmt.Fprintf(w, "    Error       : %v\n", err)
+			return fmt.Errorf("init failed: %v", err)
+		}
+
+		fmt.Fprintf(w, "[%s] DESTROY (%s)\n", mod.Path, modulePath)
+		if err := run.run(ctx, modulePath, destroyArgs()...); err != nil {
+			fmt.Fprintf(w, "✖ [%s] Terraform destroy failed!\n", mod.Path)
+			fmt.Fprintf(w, "    Module path : %s\n", modulePath)
+			fmt.Fprintf(w, "    Command     : %s\n", commandLine(mod.Binary, destroyArgs()))
+			fmt.Fprintf(w, "    Error       : %v\n", err)
+			return fmt.Errorf("destroy failed: %v", err)
+		}
+
+		return nil
+	}
+}
+
+// confirmDestroy reports whether the user confirmed destroying environment,
+// either with --confirm or by typing its name on in.
+func confirmDestroy(environment string, in io.Reader) bool {
+	if destroyConfirm != "" {
+		if destroyConfirm != environment {
+			fmt.Fprintf(out, "--confirm %q does not match the environment name %q\n", destroyConfirm, environment)
+			return false
+		}
+		return true
+	}
+
+	fmt.Fprintf(out, "\nType the environment name (%s) to confirm: ", environment)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(out)
+		return false
+	}
+	return strings.TrimSpace(answer) == environment
+}
+
+// warnRemainingDependents warns about modules that will be destroyed while a
+// module depending on them is left out by the selection.
+func warnRemainingDependents(selected, filtered []*config.ModuleNode) {
+	chosen := map[string]bool{}
+	for _, mod := range selected {
+		chosen[mod.Path] = true
+	}
+	for _, mod := range filtered {
+		for _, dep := range mod.DependsOn {
+			if chosen[dep] {
+				fmt.Fprintf(out, "Warning: %s depends on %s but is not selected for destroy\n", mod.Path, dep)
+			}
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(destroyCmd)
+	destroyCmd.Flags().StringVarP(&configPath, "config", "c", "terracotta.yaml", "Path to config file")
+	destroyCmd.Flags().StringVar(&awsProfile, "profile", "", "AWS profile to use")
+	destroyCmd.Flags().StringVar(&binaryOverride, "binary", "", "Binary to run instead of the config's binary, such as tofu; modules with their own binary keep it")
+	destroyCmd.Flags().StringVar(&versionsDirOverride, "versions-dir", "", "Directory of installed binaries as <version>/<binary> to pick from when a module needs another version")
+	destroyCmd.Flags().StringVar(&dockerImage, "docker-image", "", "Run every step in a container from this image instead of with a local binary")
+	destroyCmd.Flags().BoolVar(&upgradeProviders, "upgrade", false, "Upgrade providers to the latest version")
+	destroyCmd.Flags().StringVar(&destroyConfirm, "confirm", "", "Environment name to confirm the destroy without a prompt")
+	addSelectionFlags(destroyCmd)
+	addReportFlags(destroyCmd)
+	destroyCmd.Flags().DurationVar(&runTimeout, "timeout", 0, "Maximum duration of the whole run, e.g. 2h; running modules are interrupted and reported as timed out")
+	destroyCmd.Flags().StringVar(&logDir, "log-dir", "", "Also write the output of every terraform step to <log-dir>/<module path>/<step>.log")
+	destroyCmd.Flags().IntVar(&parallelism, "parallelism", 1, "Maximum number of modules to run concurrently")
+	destroyCmd.Flags().BoolVar(&groupOutput, "group-output", false, "With --parallelism, print the output of each module as one block when it finishes instead of line by line")
+}
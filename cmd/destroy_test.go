@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yoohya/terracotta/report"
+	"github.com/yoohya/terracotta/terraform"
+)
+
+func TestConfirmDestroy(t *testing.T) {
+	tests := []struct {
+		name    string
+		confirm string
+		input   string
+		want    bool
+	}{
+		{name: "typed environment name", input: "dev\n", want: true},
+		{name: "typed name without newline", input: "dev", want: true},
+		{name: "typed other name", input: "prod\n", want: false},
+		{name: "typed yes", input: "yes\n", want: false},
+		{name: "no input", input: "", want: false},
+		{name: "confirm flag", confirm: "dev", want: true},
+		{name: "wrong confirm flag", confirm: "prod", input: "dev\n", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destroyConfirm = tt.confirm
+			t.Cleanup(func() { destroyConfirm = "" })
+
+			if got := confirmDestroy("dev", strings.NewReader(tt.input)); got != tt.want {
+				t.Errorf("confirmDestroy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDestroyTask(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.On("b", "destroy", terraform.FakeResponse{Stderr: "Error: bucket not empty\n", ExitCode: 1})
+
+	results := runGraph(context.Background(), reverseModules(testModules()), 1, failureStop, destroyTask("envs/dev"))
+
+	if got := moduleStatus(results["b"]); got != report.StatusFailed {
+		t.Errorf("expected b to be %s, got %s", report.StatusFailed, got)
+	}
+	if _, ran := results["network"]; ran {
+		t.Error("expected network not to be destroyed after a dependent failed")
+	}
+	wantSteps := []string{
+		"envs/dev/monitoring init",
+		"envs/dev/monitoring destroy",
+		"envs/dev/c init",
+		"envs/dev/c destroy",
+		"envs/dev/b init",
+		"envs/dev/b destroy",
+	}
+	if diff := cmp.Diff(wantSteps, fakeSteps(fake)); diff != "" {
+		t.Errorf("calls mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yoohya/terracotta/config"
+	"github.com/yoohya/terracotta/terraform"
+)
+
+// dockerImage turns on Docker execution with this image, replacing the
+// image in the config.
+var dockerImage string
+
+// dockerRunner returns the runner for the docker settings d. The plugin
+// cache is created if it does not exist, and credential files that do not
+// exist are skipped with a warning rather than mounted, since Docker would
+// create them as root-owned directories.
+func dockerRunner(d config.Docker) (terraform.DockerRunner, error) {
+	if d.Image == "" {
+		return terraform.DockerRunner{}, errors.New("docker: image is required")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return terraform.DockerRunner{}, err
+	}
+
+	r := terraform.DockerRunner{
+		Image: d.Image,
+		Env:   d.Env,
+		Home:  home,
+	}
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 {
+		r.User = fmt.Sprintf("%d:%d", uid, gid)
+	}
+	if awsProfile != "" && !slices.Contains(r.Env, "AWS_PROFILE") {
+		r.Env = append(slices.Clone(r.Env), "AWS_PROFILE")
+	}
+
+	cache := d.PluginCache
+	if cache == "" {
+		cache = filepath.Join(home, ".terraform.d", "plugin-cache")
+	}
+	if r.PluginCache, err = filepath.Abs(expandHome(cache, home)); err != nil {
+		return terraform.DockerRunner{}, err
+	}
+	if err := os.MkdirAll(r.PluginCache, 0755); err != nil {
+		return terraform.DockerRunner{}, fmt.Errorf("failed to create plugin cache: %w", err)
+	}
+
+	for _, file := range d.Files {
+		path, err := filepath.Abs(expandHome(file, home))
+		if err != nil {
+			return terraform.DockerRunner{}, err
+		}
+		if _, err := os.Stat(path); err != nil {
+			fmt.Fprintf(out, "Warning: not mounting %s: %v\n", file, err)
+			continue
+		}
+		r.Files = append(r.Files, path)
+	}
+	return r, nil
+}
+
+// expandHome replaces a leading ~ in path with home.
+func expandHome(path, home string) string {
+	if path == "~" {
+		return home
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return filepath.Join(home, rest)
+	}
+	return path
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yoohya/terracotta/config"
+)
+
+func TestDockerRunner(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeFile(t, filepath.Join(home, ".aws", "credentials"), "[default]\n")
+	saved := out
+	defer func() { out = saved }()
+	var printed bytes.Buffer
+	out = &printed
+
+	r, err := dockerRunner(config.Docker{
+		Image: "ghcr.io/opentofu/opentofu:1.8",
+		Env:   []string{"AWS_REGION"},
+		Files: []string{"~/.aws", "~/.missing"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantCache := filepath.Join(home, ".terraform.d", "plugin-cache")
+	if r.PluginCache != wantCache {
+		t.Errorf("expected plugin cache %s, got %s", wantCache, r.PluginCache)
+	}
+	if _, err := os.Stat(wantCache); err != nil {
+		t.Errorf("expected the plugin cache to be created: %v", err)
+	}
+	if diff := cmp.Diff([]string{filepath.Join(home, ".aws")}, r.Files); diff != "" {
+		t.Errorf("files mismatch (-want +got):\n%s", diff)
+	}
+	if !strings.Contains(printed.String(), "not mounting ~/.missing") {
+		t.Errorf("expected a warning about the missing file, got %q", printed.String())
+	}
+	if r.Home != home {
+		t.Errorf("expected HOME %s, got %s", home, r.Home)
+	}
+
+	if _, err := dockerRunner(config.Docker{}); err == nil {
+		t.Error("expected an error without an image")
+	}
+}
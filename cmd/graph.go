@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yoohya/terracotta/config"
+)
+
+var graphFormat string
+var graphHighlight string
+var graphFence bool
+
+// Roles of highlighted modules in graph output.
+const (
+	roleSelected   = "selected"
+	roleUpstream   = "upstream"
+	roleDownstream = "downstream"
+)
+
+type graphNode struct {
+	Path      string   `json:"path"`
+	DependsOn []string `json:"depends_on"`
+	Tags      []string `json:"tags,omitempty"`
+	Wave      int      `json:"wave"`
+	Role      string   `json:"role,omitempty"`
+}
+
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type graphDocument struct {
+	Nodes     []graphNode `json:"nodes"`
+	Edges     []graphEdge `json:"edges"`
+	Waves     [][]string  `json:"waves"`
+	Highlight string      `json:"highlight,omitempty"`
+}
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Export the module dependency graph as DOT, Mermaid or JSON",
+	Long: `Graph prints the module dependency graph. Edges point from a module to the
+modules that depend on it, following the order in which they run.
+
+With --highlight, the chosen module, the modules it depends on (upstream) and
+the modules that depend on it (downstream) are marked.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.LoadConfig(configPath)
+		if err != nil {
+			fmt.Printf("Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+
+		graph, err := config.BuildExecutionGraph(cfg)
+		if err != nil {
+			fmt.Printf("Failed to build execution graph: %v\n", err)
+			os.Exit(1)
+		}
+
+		doc, err := buildGraphDocument(graph, graphHighlight)
+		if err != nil {
+			fmt.Printf("Failed to build graph: %v\n", err)
+			os.Exit(1)
+		}
+
+		switch graphFormat {
+		case "dot":
+			err = writeDOT(os.Stdout, doc)
+		case "mermaid":
+			err = writeMermaid(os.Stdout, doc, graphFence)
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(doc)
+		default:
+			err = fmt.Errorf("unknown format %q: must be dot, mermaid or json", graphFormat)
+		}
+		if err != nil {
+			fmt.Printf("Failed to write graph: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// buildGraphDocument collects the nodes, edges and waves of graph. When
+// highlight is set, every node related to it gets a role.
+func buildGraphDocument(graph *config.ExecutionGraph, highlight string) (*graphDocument, error) {
+	levels, err := graph.Levels()
+	if err != nil {
+		return nil, err
+	}
+
+	roles := map[string]string{}
+	if highlight != "" {
+		if _, exists := graph.Nodes[highlight]; !exists {
+			return nil, fmt.Errorf("module %s is not defined in the config", highlight)
+		}
+		roles[highlight] = roleSelected
+		for _, path := range graph.Dependencies(highlight) {
+			roles[path] = roleUpstream
+		}
+		for _, path := range graph.Dependents(highlight) {
+			roles[path] = roleDownstream
+		}
+	}
+
+	doc := &graphDocument{
+		Nodes:     []graphNode{},
+		Edges:     []graphEdge{},
+		Waves:     [][]string{},
+		Highlight: highlight,
+	}
+	wave := map[string]int{}
+	for i, mods := range levels {
+		var paths []string
+		for _, mod := range mods {
+			paths = append(paths, mod.Path)
+			wave[mod.Path] = i + 1
+		}
+		doc.Waves = append(doc.Waves, paths)
+	}
+
+	sorted, err := graph.TopoSortedModules()
+	if err != nil {
+		return nil, err
+	}
+	for _, mod := range sorted {
+		dependsOn := mod.DependsOn
+		if dependsOn == nil {
+			dependsOn = []string{}
+		}
+		doc.Nodes = append(doc.Nodes, graphNode{
+			Path:      mod.Path,
+			DependsOn: dependsOn,
+			Tags:      mod.Tags,
+			Wave:      wave[mod.Path],
+			Role:      roles[mod.Path],
+		})
+		for _, dep := range mod.DependsOn {
+			doc.Edges = append(doc.Edges, graphEdge{From: dep, To: mod.Path})
+		}
+	}
+
+	return doc, nil
+}
+
+// roleColors maps highlight roles to fill colors used by DOT and Mermaid.
+var roleColors = map[string]string{
+	roleSelected:   "#f9d71c",
+	roleUpstream:   "#a6d8ff",
+	roleDownstream: "#ffc2a6",
+}
+
+func writeDOT(w io.Writer, doc *graphDocument) error {
+	var err error
+	printf := func(format string, args ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	printf("digraph terracotta {\n")
+	printf("  rankdir=LR;\n")
+	printf("  node [shape=box];\n")
+	for _, node := range doc.Nodes {
+		if color, ok := roleColors[node.Role]; ok {
+			printf("  %q [style=filled, fillcolor=%q];\n", node.Path, color)
+		} else {
+			printf("  %q;\n", node.Path)
+		}
+	}
+	for _, edge := range doc.Edges {
+		printf("  %q -> %q;\n", edge.From, edge.To)
+	}
+	printf("}\n")
+	return err
+}
+
+func writeMermaid(w io.Writer, doc *graphDocument, fence bool) error {
+	var err error
+	printf := func(format string, args ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	// Mermaid ids cannot contain slashes, so nodes get positional ids and
+	// the module path is used as the label.
+	ids := map[string]string{}
+	for i, node := range doc.Nodes {
+		ids[node.Path] = fmt.Sprintf("m%d", i)
+	}
+
+	if fence {
+		printf("```mermaid\n")
+	}
+	printf("flowchart LR\n")
+	for _, node := range doc.Nodes {
+		printf("  %s[\"%s\"]\n", ids[node.Path], node.Path)
+	}
+	for _, edge := range doc.Edges {
+		printf("  %s --> %s\n", ids[edge.From], ids[edge.To])
+	}
+	for _, role := range []string{roleSelected, roleUpstream, roleDownstream} {
+		var members []string
+		for _, node := range doc.Nodes {
+			if node.Role == role {
+				members = append(members, ids[node.Path])
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+		printf("  classDef %s fill:%s\n", role, roleColors[role])
+		printf("  class %s %s\n", strings.Join(members, ","), role)
+	}
+	if fence {
+		printf("```\n")
+	}
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(graphCmd)
+	graphCmd.Flags().StringVarP(&configPath, "config", "c", "terracotta.yaml", "Path to config file")
+	graphCmd.Flags().StringVarP(&graphFormat, "format", "f", "mermaid", "Output format: dot, mermaid or json")
+	graphCmd.Flags().StringVar(&graphHighlight, "highlight", "", "Module whose upstream and downstream modules are highlighted")
+	graphCmd.Flags().BoolVar(&graphFence, "fence", true, "Wrap Mermaid output in a ```mermaid code block for Markdown")
+}
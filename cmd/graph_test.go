@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yoohya/terracotta/config"
+)
+
+func testGraph(t *testing.T) *config.ExecutionGraph {
+	t.Helper()
+	graph, err := config.BuildExecutionGraph(&config.Config{
+		Modules: []config.Module{
+			{Path: "shared/network"},
+			{Path: "app/backend", DependsOn: []string{"shared/network"}},
+			{Path: "shared/monitoring", DependsOn: []string{"app/backend"}},
+			{Path: "shared/dns"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to build graph: %v", err)
+	}
+	return graph
+}
+
+func TestBuildGraphDocumentHighlight(t *testing.T) {
+	doc, err := buildGraphDocument(testGraph(t), "app/backend")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := map[string]string{}
+	for _, node := range doc.Nodes {
+		got[node.Path] = node.Role
+	}
+	want := map[string]string{
+		"shared/network":    roleUpstream,
+		"app/backend":       roleSelected,
+		"shared/monitoring": roleDownstream,
+		"shared/dns":        "",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("roles mismatch (-want +got):\n%s", diff)
+	}
+
+	wantWaves := [][]string{{"shared/network", "shared/dns"}, {"app/backend"}, {"shared/monitoring"}}
+	if diff := cmp.Diff(wantWaves, doc.Waves); diff != "" {
+		t.Errorf("waves mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildGraphDocumentUnknownHighlight(t *testing.T) {
+	if _, err := buildGraphDocument(testGraph(t), "missing"); err == nil {
+		t.Error("expected error for unknown module but got none")
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	doc, err := buildGraphDocument(testGraph(t), "shared/network")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeMermaid(&buf, doc, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "```mermaid\n" +
+		"flowchart LR\n" +
+		"  m0[\"shared/network\"]\n" +
+		"  m1[\"app/backend\"]\n" +
+		"  m2[\"shared/monitoring\"]\n" +
+		"  m3[\"shared/dns\"]\n" +
+		"  m0 --> m1\n" +
+		"  m1 --> m2\n" +
+		"  classDef selected fill:#f9d71c\n" +
+		"  class m0 selected\n" +
+		"  classDef downstream fill:#ffc2a6\n" +
+		"  class m1,m2 downstream\n" +
+		"```\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("writeMermaid() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	doc, err := buildGraphDocument(testGraph(t), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeDOT(&buf, doc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "digraph terracotta {\n" +
+		"  rankdir=LR;\n" +
+		"  node [shape=box];\n" +
+		"  \"shared/network\";\n" +
+		"  \"app/backend\";\n" +
+		"  \"shared/monitoring\";\n" +
+		"  \"shared/dns\";\n" +
+		"  \"shared/network\" -> \"app/backend\";\n" +
+		"  \"app/backend\" -> \"shared/monitoring\";\n" +
+		"}\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("writeDOT() mismatch (-want +got):\n%s", diff)
+	}
+}
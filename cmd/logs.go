@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var logDir string
+
+// logFilePath returns the log file for one step of a module under dir.
+func logFilePath(dir, modulePath, step string) string {
+	return filepath.Join(dir, filepath.FromSlash(modulePath), step+".log")
+}
+
+// openLog opens the log file for step of the module in --log-dir. A step
+// that runs more than once in a run is appended to the same file.
+func (r *moduleRun) openLog(step string) (*timestampWriter, error) {
+	path := logFilePath(logDir, r.Module.Path, step)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !r.logged[path] {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.logged == nil {
+		r.logged = map[string]bool{}
+	}
+	r.logged[path] = true
+	r.LogFile = path
+	return &timestampWriter{w: f, closer: f, now: time.Now}, nil
+}
+
+// timestampWriter writes every line written to it to w, prefixed with the
+// time it was written.
+type timestampWriter struct {
+	w      io.Writer
+	closer io.Closer
+	now    func() time.Time
+	buf    []byte
+}
+
+func (t *timestampWriter) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	for {
+		i := bytes.IndexByte(t.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := t.writeLine(t.buf[:i+1]); err != nil {
+			return len(p), err
+		}
+		t.buf = t.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close writes a final line that has no newline and closes the file.
+func (t *timestampWriter) Close() error {
+	var err error
+	if len(t.buf) > 0 {
+		err = t.writeLine(append(t.buf, '\n'))
+		t.buf = nil
+	}
+	if cerr := t.closer.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (t *timestampWriter) writeLine(line []byte) error {
+	_, err := io.WriteString(t.w, t.now().Format(time.RFC3339)+" "+string(line))
+	return err
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yoohya/terracotta/config"
+	"github.com/yoohya/terracotta/terraform"
+)
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func TestTimestampWriter(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	w := &timestampWriter{w: &buf, closer: nopCloser{}, now: func() time.Time { return now }}
+
+	_, _ = w.Write([]byte("[a] first\n[a] sec"))
+	now = now.Add(time.Second)
+	_, _ = w.Write([]byte("ond\n[a] partial"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "2024-05-01T09:00:00Z [a] first\n" +
+		"2024-05-01T09:00:01Z [a] second\n" +
+		"2024-05-01T09:00:01Z [a] partial\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("log mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOpenLog(t *testing.T) {
+	saved := logDir
+	defer func() { logDir = saved }()
+	logDir = t.TempDir()
+
+	path := logFilePath(logDir, "shared/network", "plan")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "from an earlier run\n")
+
+	run := &moduleRun{Module: &config.ModuleNode{Path: "shared/network"}}
+	for _, line := range []string{"attempt 1\n", "attempt 2\n"} {
+		w, err := run.openLog("plan")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		w.now = func() time.Time { return time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC) }
+		_, _ = w.Write([]byte(line))
+		if err := w.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if run.LogFile != path {
+		t.Errorf("expected LogFile %s, got %s", path, run.LogFile)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2024-05-01T09:00:00Z attempt 1\n2024-05-01T09:00:00Z attempt 2\n"
+	if diff := cmp.Diff(want, string(data)); diff != "" {
+		t.Errorf("log file mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunOnceLogsFailures(t *testing.T) {
+	saved := logDir
+	defer func() { logDir = saved }()
+	logDir = t.TempDir()
+
+	tests := []struct {
+		name       string
+		args       []string
+		exitCode   int
+		wantFailed bool
+	}{
+		{name: "plan with changes", args: []string{"plan", "-detailed-exitcode"}, exitCode: 2},
+		{name: "failed plan", args: []string{"plan", "-detailed-exitcode"}, exitCode: 1, wantFailed: true},
+		{name: "apply exiting with 2", args: []string{"apply", "-auto-approve"}, exitCode: 2, wantFailed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFakeRunner(t)
+			fake.On("network", tt.args[0], terraform.FakeResponse{ExitCode: tt.exitCode})
+
+			run := &moduleRun{Module: &config.ModuleNode{Path: "network"}, Out: io.Discard}
+			if _, err := run.runOnce(context.Background(), "network", tt.args...); err == nil {
+				t.Fatal("expected the exit status to be returned")
+			}
+
+			data, err := os.ReadFile(run.LogFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(string(data), "Failed:"); got != tt.wantFailed {
+				t.Errorf("expected the log to report a failure: %v, got log:\n%s", tt.wantFailed, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifestVersion is bumped whenever the manifest format changes in a way
+// older versions of terracotta cannot read.
+const manifestVersion = 1
+
+// manifestFile is the name of the manifest written to a plan output directory.
+const manifestFile = "manifest.json"
+
+// planFileName is the name of the plan file written for each module.
+const planFileName = "tfplan"
+
+// Plan statuses recorded in a manifest.
+const (
+	manifestPlanned = "planned"
+	manifestFailed  = "failed"
+)
+
+// planManifest describes the plan files saved by plan --out-dir, so that
+// apply --from-plan can apply exactly what was reviewed.
+type planManifest struct {
+	Version    int              `json:"version"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Config     string           `json:"config"`
+	ConfigHash string           `json:"config_hash"`
+	Modules    []manifestModule `json:"modules"`
+}
+
+type manifestModule struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	// PlanFile is relative to the output directory.
+	PlanFile   string `json:"plan_file,omitempty"`
+	HasChanges bool   `json:"has_changes"`
+}
+
+// planFilePath returns the absolute path of the plan file for a module in
+// outDir. It is absolute because terraform runs inside the module directory.
+func planFilePath(outDir, modulePath string) (string, error) {
+	return filepath.Abs(filepath.Join(outDir, filepath.FromSlash(modulePath), planFileName))
+}
+
+// hashFile returns the SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func writeManifest(outDir string, m *planManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outDir, manifestFile), append(data, '\n'), 0644)
+}
+
+func readManifest(outDir string) (*planManifest, error) {
+	data, err := os.ReadFile(filepath.Join(outDir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m planManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// checkManifest verifies that the plans in m can still be applied: the config
+// file must be unchanged and every module must have a saved plan file.
+func checkManifest(outDir string, m *planManifest, cfgPath string) error {
+	hash, err := hashFile(cfgPath)
+	if err != nil {
+		return err
+	}
+	if hash != m.ConfigHash {
+		return fmt.Errorf("config %s changed since the plan was created", cfgPath)
+	}
+
+	for _, mod := range m.Modules {
+		if mod.Status != manifestPlanned {
+			return fmt.Errorf("module %s has no plan: its plan %s", mod.Path, mod.Status)
+		}
+		if _, err := os.Stat(filepath.Join(outDir, mod.PlanFile)); err != nil {
+			return fmt.Errorf("plan file for module %s is missing: %w", mod.Path, err)
+		}
+	}
+	return nil
+}
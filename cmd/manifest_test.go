@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "terracotta.yaml")
+	writeFile(t, cfgPath, "base_path: envs/dev\n")
+	hash, err := hashFile(cfgPath)
+	if err != nil {
+		t.Fatalf("failed to hash config: %v", err)
+	}
+
+	outDir := filepath.Join(dir, "runs", "1")
+	writeFile(t, filepath.Join(outDir, "network", planFileName), "plan")
+	m := &planManifest{
+		Version:    manifestVersion,
+		CreatedAt:  time.Now().UTC(),
+		Config:     cfgPath,
+		ConfigHash: hash,
+		Modules: []manifestModule{
+			{Path: "network", Status: manifestPlanned, PlanFile: filepath.Join("network", planFileName)},
+		},
+	}
+	if err := writeManifest(outDir, m); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	got, err := readManifest(outDir)
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	if err := checkManifest(outDir, got, cfgPath); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckManifest(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "terracotta.yaml")
+	writeFile(t, cfgPath, "base_path: envs/dev\n")
+	hash, err := hashFile(cfgPath)
+	if err != nil {
+		t.Fatalf("failed to hash config: %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "network", planFileName), "plan")
+
+	tests := []struct {
+		name    string
+		hash    string
+		modules []manifestModule
+		wantErr string
+	}{
+		{
+			name:    "config changed",
+			hash:    "sha256:other",
+			wantErr: "changed since the plan",
+		},
+		{
+			name:    "plan file missing",
+			hash:    hash,
+			modules: []manifestModule{{Path: "db", Status: manifestPlanned, PlanFile: filepath.Join("db", planFileName)}},
+			wantErr: "plan file for module db is missing",
+		},
+		{
+			name:    "plan failed",
+			hash:    hash,
+			modules: []manifestModule{{Path: "db", Status: manifestFailed}},
+			wantErr: "module db has no plan",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &planManifest{Version: manifestVersion, ConfigHash: tt.hash, Modules: tt.modules}
+			err := checkManifest(dir, m, cfgPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/yoohya/terracotta/config"
+)
+
+var orderCommand string
+
+var orderCmd = &cobra.Command{
+	Use:   "order",
+	Short: "Show the execution waves and the commands each module would run",
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := orderSteps(orderCommand, ""); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		reverse := orderCommand == "destroy"
+
+		cfg, err := config.LoadConfig(configPath)
+		if err != nil {
+			fmt.Printf("Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+		if binaryOverride != "" {
+			cfg.Binary = binaryOverride
+		}
+
+		graph, err := config.BuildExecutionGraph(cfg)
+		if err != nil {
+			fmt.Printf("Failed to build execution graph: %v\n", err)
+			os.Exit(1)
+		}
+
+		levels, err := graph.Levels()
+		if err != nil {
+			fmt.Printf("Failed to resolve module order: %v\n", err)
+			os.Exit(1)
+		}
+
+		var all []*config.ModuleNode
+		for _, wave := range levels {
+			all = append(all, wave...)
+		}
+		selected, filtered, err := selectModules(cfg, graph, all)
+		if err != nil {
+			fmt.Printf("Failed to select modules: %v\n", err)
+			os.Exit(1)
+		}
+		chosen := map[string]bool{}
+		for _, mod := range selected {
+			chosen[mod.Path] = true
+		}
+
+		var waves [][]*config.ModuleNode
+		for _, wave := range levels {
+			var mods []*config.ModuleNode
+			for _, mod := range wave {
+				if chosen[mod.Path] {
+					mods = append(mods, mod)
+				}
+			}
+			if len(mods) > 0 {
+				waves = append(waves, mods)
+			}
+		}
+		if reverse {
+			// destroy handles dependents before the modules they depend on.
+			for i, j := 0, len(waves)-1; i < j; i, j = i+1, j-1 {
+				waves[i], waves[j] = waves[j], waves[i]
+			}
+		}
+
+		for i, wave := range waves {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("Wave %d:\n", i+1)
+			for _, mod := range wave {
+				fmt.Printf("  %s (%s)\n", mod.Path, filepath.Join(cfg.BasePath, mod.Path))
+				steps, _ := orderSteps(orderCommand, mod.Path)
+				for _, step := range steps {
+					fmt.Printf("    $ %s\n", commandLine(mod.Binary, step))
+				}
+			}
+		}
+		printFiltered(filtered)
+	},
+}
+
+// orderPlanDir stands in for the plan directory in the commands shown by
+// order, since plan picks a temporary directory unless --out-dir is given.
+const orderPlanDir = "<plan-dir>"
+
+// orderSteps returns the arguments of every step command runs for the module
+// at modulePath, built the same way as by the tasks that run them. For plan
+// the show step runs only when the plan has changes.
+func orderSteps(command, modulePath string) ([][]string, error) {
+	switch command {
+	case "plan":
+		planFile := filepath.Join(orderPlanDir, filepath.FromSlash(modulePath), planFileName)
+		return [][]string{initArgs(), planArgs(planFile), showArgs(planFile)}, nil
+	case "apply":
+		return [][]string{initArgs(), applyArgs("")}, nil
+	case "destroy":
+		return [][]string{initArgs(), destroyArgs()}, nil
+	}
+	return nil, fmt.Errorf("unknown command %q: must be plan, apply or destroy", command)
+}
+
+func init() {
+	rootCmd.AddCommand(orderCmd)
+	orderCmd.Flags().StringVarP(&configPath, "config", "c", "terracotta.yaml", "Path to config file")
+	orderCmd.Flags().StringVar(&orderCommand, "command", "plan", "Command to show: plan, apply or destroy")
+	orderCmd.Flags().StringVar(&binaryOverride, "binary", "", "Binary to run instead of the config's binary, such as tofu; modules with their own binary keep it")
+	orderCmd.Flags().BoolVar(&upgradeProviders, "upgrade", false, "Upgrade providers to the latest version")
+	addSelectionFlags(orderCmd)
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOrderSteps(t *testing.T) {
+	planFile := filepath.Join(orderPlanDir, "shared", "network", planFileName)
+	tests := []struct {
+		command string
+		want    [][]string
+	}{
+		{command: "plan", want: [][]string{
+			{"init", "-input=false"},
+			{"plan", "-input=false", "-detailed-exitcode", "-out=" + planFile},
+			{"show", "-json", planFile},
+		}},
+		{command: "apply", want: [][]string{{"init", "-input=false"}, {"apply", "-auto-approve"}}},
+		{command: "destroy", want: [][]string{{"init", "-input=false"}, {"destroy", "-auto-approve"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got, err := orderSteps(tt.command, "shared/network")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("orderSteps() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := orderSteps("refresh", "shared/network"); err == nil {
+		t.Error("expected an error for an unknown command")
+	}
+}
@@ -1,95 +1,250 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
-	"github.com/yoohya/terracotta/config"
+	"github.com/yoohya/terracotta/report"
 	"github.com/yoohya/terracotta/terraform"
 )
 
-type planResult struct {
-	Module string
-	Error  error
-}
+var planOutDir string
+var planExitCode bool
+var planShowResources bool
+var planOnFailure string
 
 var planCmd = &cobra.Command{
 	Use:   "plan",
 	Short: "Plan Terraform modules",
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.LoadConfig(configPath)
+		started := time.Now()
+		cfg, _, sortedModules, filteredModules := prepareRun()
+		binaries := detectBinaries(context.Background(), sortedModules, cfg.VersionsDir)
+		onFailure, err := parseFailurePolicy(planOnFailure)
 		if err != nil {
-			fmt.Printf("Failed to load config: %v\n", err)
+			fmt.Fprintln(out, err)
 			os.Exit(1)
 		}
 
-		graph, err := config.BuildExecutionGraph(cfg)
-		if err != nil {
-			fmt.Printf("Failed to build execution graph: %v\n", err)
-			os.Exit(1)
+		var configHash string
+		if planOutDir != "" {
+			hash, err := hashFile(configPath)
+			if err != nil {
+				fmt.Fprintf(out, "Failed to read config: %v\n", err)
+				os.Exit(1)
+			}
+			configHash = hash
 		}
 
-		sortedModules, err := graph.TopoSortedModules()
+		planDir, err := preparePlanDir(planOutDir)
 		if err != nil {
-			fmt.Printf("Failed to resolve module order: %v\n", err)
+			fmt.Fprintf(out, "Failed to create plan directory: %v\n", err)
 			os.Exit(1)
 		}
 
-		if awsProfile != "" {
-			if err := os.Setenv("AWS_PROFILE", awsProfile); err != nil {
-				fmt.Printf("Warning: failed to set AWS_PROFILE: %v\n", err)
+		ctx, cancel := runContext()
+		defer cancel()
+		runs := runGraph(ctx, sortedModules, parallelism, onFailure, planTask(cfg.BasePath, planDir))
+
+		rep := buildReport(ctx, "plan", started, sortedModules, runs, filteredModules)
+		rep.Binaries = reportBinaries(binaries)
+
+		var manifestErr error
+		if planOutDir != "" {
+			manifestErr = writeManifest(planOutDir, buildManifest(rep, configHash))
+		}
+
+		fmt.Fprintln(out, "\nPlan Summary:")
+		printBinaries(binaries)
+		var changed bool
+		for _, res := range rep.Modules {
+			switch res.Status {
+			case report.StatusFailed:
+				fmt.Fprintf(out, "✖ %s: %s\n", res.Path, res.Error)
+			case report.StatusInterrupted:
+				fmt.Fprintf(out, "⏹ %s: interrupted\n", res.Path)
+			case report.StatusTimedOut:
+				fmt.Fprintf(out, "⏱ %s: timed out - %s\n", res.Path, res.Error)
+			case report.StatusChanges:
+				changed = true
+				if res.Changes == nil {
+					fmt.Fprintf(out, "± %s: changes pending\n", res.Path)
+				} else {
+					fmt.Fprintf(out, "± %s: changes pending (%s)\n", res.Path, formatChanges(res.Changes))
+				}
+				if planShowResources && res.Changes != nil {
+					printResourceAddresses(res.Changes)
+				}
+			case report.StatusNoChanges:
+				fmt.Fprintf(out, "✔ %s: no changes\n", res.Path)
+			case report.StatusSkipped:
+				fmt.Fprintf(out, "⏭ %s: skipped%s\n", res.Path, blockedNote(res))
 			}
+			printModuleDetails(res)
+		}
+		total := &report.Changes{}
+		if rep.Changes != nil {
+			total = rep.Changes
+		}
+		fmt.Fprintf(out, "Total: %s\n", formatChanges(total))
+		printFiltered(filteredModules)
+		switch {
+		case planOutDir == "":
+			_ = os.RemoveAll(planDir)
+		case manifestErr == nil:
+			fmt.Fprintf(out, "\nPlan files saved to %s\n", planOutDir)
 		}
 
-		var results []planResult
+		writeReports(rep)
+		if manifestErr != nil {
+			fmt.Fprintf(out, "Failed to write plan manifest: %v\n", manifestErr)
+		}
+		if rep.Status == report.StatusInterrupted {
+			os.Exit(exitInterrupted)
+		}
+		if rep.Failed() || manifestErr != nil {
+			os.Exit(1)
+		}
+		if planExitCode && changed {
+			os.Exit(2)
+		}
+	},
+}
 
-		for _, mod := range sortedModules {
-			modulePath := filepath.Join(cfg.BasePath, mod.Path)
-			fmt.Printf("[%s] INIT (%s)\n", mod.Path, modulePath)
-			// init コマンドの引数を構築
-			initArgs := []string{"init", "-input=false"}
-			if upgradeProviders {
-				initArgs = append(initArgs, "-upgrade")
-				fmt.Printf("[%s] Provider upgrade enabled\n", mod.Path)
-			}
+// preparePlanDir creates the directory plans are saved in and returns it.
+// Plans are always saved so that their resource changes can be read with
+// terraform show -json. Without --out-dir they go to a temporary directory.
+// The --out-dir directory is created up front, so that the manifest can be
+// written even when no module gets as far as planning.
+func preparePlanDir(outDir string) (string, error) {
+	if outDir == "" {
+		return os.MkdirTemp("", "terracotta-plan-")
+	}
+	return outDir, os.MkdirAll(outDir, 0755)
+}
 
-			if err := terraform.RunCommand(mod.Path, modulePath, initArgs...); err != nil {
-				fmt.Printf("[%s] Error running init: %v\n", mod.Path, err)
-				results = append(results, planResult{Module: mod.Path, Error: fmt.Errorf("init failed: %v", err)})
-				continue
-			}
+// buildManifest describes the plans of rep for the manifest of plan
+// --out-dir. Modules that were not selected are left out and modules that
+// were not planned are recorded as failed.
+func buildManifest(rep *report.Report, configHash string) *planManifest {
+	manifest := &planManifest{
+		Version:    manifestVersion,
+		CreatedAt:  time.Now().UTC(),
+		Config:     configPath,
+		ConfigHash: configHash,
+	}
+	for _, res := range rep.Modules {
+		mod := manifestModule{Path: res.Path}
+		switch res.Status {
+		case report.StatusNotSelected:
+			continue
+		case report.StatusChanges, report.StatusNoChanges:
+			mod.Status = manifestPlanned
+			mod.PlanFile = filepath.Join(filepath.FromSlash(res.Path), planFileName)
+			mod.HasChanges = res.Status == report.StatusChanges
+		default:
+			mod.Status = manifestFailed
+		}
+		manifest.Modules = append(manifest.Modules, mod)
+	}
+	return manifest
+}
 
-			fmt.Printf("[%s] PLAN (%s)\n", mod.Path, modulePath)
-			if err := terraform.RunCommand(mod.Path, modulePath, "plan"); err != nil {
-				fmt.Printf("[%s] Error running plan: %v\n", mod.Path, err)
-				results = append(results, planResult{Module: mod.Path, Error: fmt.Errorf("plan failed: %v", err)})
-				continue
-			}
+// planTask returns the task that plans a module of basePath, saving its plan
+// under planDir and reading the resource changes from the saved plan.
+func planTask(basePath, planDir string) moduleTask {
+	return func(ctx context.Context, run *moduleRun) error {
+		mod, w := run.Module, run.Out
+		modulePath := filepath.Join(basePath, mod.Path)
+		fmt.Fprintf(w, "[%s] INIT (%s)\n", mod.Path, modulePath)
+		if upgradeProviders {
+			fmt.Fprintf(w, "[%s] Provider upgrade enabled\n", mod.Path)
+		}
 
-			results = append(results, planResult{Module: mod.Path, Error: nil})
+		if err := run.run(ctx, modulePath, initArgs()...); err != nil {
+			fmt.Fprintf(w, "[%s] Error running init: %v\n", mod.Path, err)
+			return fmt.Errorf("init failed: %v", err)
 		}
 
-		fmt.Println("\nPlan Summary:")
-		var failed bool
-		for _, res := range results {
-			if res.Error != nil {
-				fmt.Printf("✖ %s: %v\n", res.Module, res.Error)
-				failed = true
-			} else {
-				fmt.Printf("✔ %s: plan succeeded\n", res.Module)
-			}
+		planFile, err := planFilePath(planDir, mod.Path)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(planFile), 0755)
 		}
-		if failed {
-			os.Exit(1)
+		if err != nil {
+			fmt.Fprintf(w, "[%s] Error preparing plan file: %v\n", mod.Path, err)
+			return fmt.Errorf("plan failed: %v", err)
 		}
-	},
+
+		fmt.Fprintf(w, "[%s] PLAN (%s)\n", mod.Path, modulePath)
+		changes, err := terraform.PlanChanges(run.run(ctx, modulePath, planArgs(planFile)...))
+		if err != nil {
+			fmt.Fprintf(w, "[%s] Error running plan: %v\n", mod.Path, err)
+			return fmt.Errorf("plan failed: %v", err)
+		}
+		if !changes {
+			run.Status = report.StatusNoChanges
+			return nil
+		}
+
+		run.Status = report.StatusChanges
+		output, err := terraform.Collect(ctx, runner, terraform.Invocation{Command: mod.Binary, Dir: modulePath, Args: showArgs(planFile)})
+		if err == nil {
+			run.Changes, err = terraform.ParsePlanJSON(output)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "[%s] Warning: failed to read resource changes: %v\n", mod.Path, err)
+		}
+		return nil
+	}
+}
+
+// formatChanges formats resource change counts as "+3 ~1 -2".
+func formatChanges(c *report.Changes) string {
+	return terraform.ResourceChanges{Add: c.Add, Change: c.Change, Destroy: c.Destroy}.String()
+}
+
+// resourceActionSymbols are the markers used when listing changed resources,
+// in the order the actions are listed.
+var resourceActionSymbols = []struct {
+	action string
+	symbol string
+}{
+	{terraform.ActionCreate, "+"},
+	{terraform.ActionUpdate, "~"},
+	{terraform.ActionReplace, "-/+"},
+	{terraform.ActionDelete, "-"},
+}
+
+// printResourceAddresses lists the changed resources of a module grouped by
+// action.
+func printResourceAddresses(changes *report.Changes) {
+	for _, a := range resourceActionSymbols {
+		for _, address := range changes.Resources[a.action] {
+			fmt.Fprintf(out, "    %-3s %s\n", a.symbol, address)
+		}
+	}
 }
 
 func init() {
 	rootCmd.AddCommand(planCmd)
 	planCmd.Flags().StringVarP(&configPath, "config", "c", "terracotta.yaml", "Path to config file")
 	planCmd.Flags().StringVar(&awsProfile, "profile", "", "AWS profile to use")
+	planCmd.Flags().StringVar(&binaryOverride, "binary", "", "Binary to run instead of the config's binary, such as tofu; modules with their own binary keep it")
+	planCmd.Flags().StringVar(&versionsDirOverride, "versions-dir", "", "Directory of installed binaries as <version>/<binary> to pick from when a module needs another version")
+	planCmd.Flags().StringVar(&dockerImage, "docker-image", "", "Run every step in a container from this image instead of with a local binary")
 	planCmd.Flags().BoolVar(&upgradeProviders, "upgrade", false, "Upgrade providers to the latest version")
+	addSelectionFlags(planCmd)
+	planCmd.Flags().StringVar(&planOutDir, "out-dir", "", "Save a plan file per module and a manifest in this directory, for apply --from-plan")
+	planCmd.Flags().BoolVar(&planExitCode, "exit-code", false, "Exit with status 2 when any module has pending changes")
+	planCmd.Flags().BoolVar(&planShowResources, "show-resources", false, "List changed resource addresses by action under each module in the summary")
+	planCmd.Flags().StringVar(&planOnFailure, "on-failure", string(failureSkipDependents), "What to do when a module fails: stop, continue or skip-dependents")
+	addReportFlags(planCmd)
+	planCmd.Flags().DurationVar(&runTimeout, "timeout", 0, "Maximum duration of the whole run, e.g. 2h; running modules are interrupted and reported as timed out")
+	planCmd.Flags().StringVar(&logDir, "log-dir", "", "Also write the output of every terraform step to <log-dir>/<module path>/<step>.log")
+	planCmd.Flags().IntVar(&parallelism, "parallelism", 1, "Maximum number of modules to run concurrently")
+	planCmd.Flags().BoolVar(&groupOutput, "group-output", false, "With --parallelism, print the output of each module as one block when it finishes instead of line by line")
 }
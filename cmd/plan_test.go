@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yoohya/terracotta/report"
+	"github.com/yoohya/terracotta/terraform"
+)
+
+func TestPlanTask(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.On("a", "plan", terraform.FakeResponse{Stderr: "Error: invalid reference\n", ExitCode: 1})
+	fake.On("b", "plan", terraform.FakeResponse{ExitCode: 2})
+	fake.On("b", "show", terraform.FakeResponse{Stdout: `{"resource_changes": [{"address": "aws_s3_bucket.logs", "change": {"actions": ["create"]}}]}`})
+
+	results := runGraph(context.Background(), testModules(), 1, failureSkipDependents, planTask("envs/dev", t.TempDir()))
+
+	want := map[string]string{
+		"network":    report.StatusNoChanges,
+		"a":          report.StatusFailed,
+		"b":          report.StatusChanges,
+		"c":          report.StatusNoChanges,
+		"monitoring": report.StatusSkipped,
+	}
+	for path, status := range want {
+		if got := moduleStatus(results[path]); got != status {
+			t.Errorf("expected %s to be %s, got %s", path, status, got)
+		}
+	}
+	if got := results["a"].Err.Error(); got != "plan failed: exit status 1" {
+		t.Errorf("unexpected error for a: %s", got)
+	}
+	if got := results["b"].Changes; got == nil || got.Add != 1 {
+		t.Errorf("expected b to add 1 resource, got %+v", got)
+	}
+
+	wantSteps := []string{
+		"envs/dev/network init",
+		"envs/dev/network plan",
+		"envs/dev/a init",
+		"envs/dev/a plan",
+		"envs/dev/b init",
+		"envs/dev/b plan",
+		"envs/dev/b show",
+		"envs/dev/c init",
+		"envs/dev/c plan",
+	}
+	if diff := cmp.Diff(wantSteps, fakeSteps(fake)); diff != "" {
+		t.Errorf("calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPlanManifestWhenEveryInitFails(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Default = terraform.FakeResponse{Stderr: "Error: Failed to query available provider packages\n", ExitCode: 1}
+
+	outDir := filepath.Join(t.TempDir(), "runs", "x")
+	planDir, err := preparePlanDir(outDir)
+	if err != nil {
+		t.Fatalf("failed to prepare plan directory: %v", err)
+	}
+
+	modules := testModules()
+	runs := runGraph(context.Background(), modules, 1, failureContinue, planTask("envs/dev", planDir))
+	rep := buildReport(context.Background(), "plan", time.Now(), modules, runs, nil)
+	if err := writeManifest(outDir, buildManifest(rep, "sha256:abc")); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	got, err := readManifest(outDir)
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	var want []manifestModule
+	for _, mod := range modules {
+		want = append(want, manifestModule{Path: mod.Path, Status: manifestFailed})
+	}
+	if diff := cmp.Diff(want, got.Modules); diff != "" {
+		t.Errorf("manifest modules mismatch (-want +got):\n%s", diff)
+	}
+}
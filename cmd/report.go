@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yoohya/terracotta/config"
+	"github.com/yoohya/terracotta/report"
+	"github.com/yoohya/terracotta/terraform"
+)
+
+var reportPath string
+var junitPath string
+var markdownPath string
+var markdownMaxSize int
+var outputFormat string
+
+// addReportFlags registers the report output flags on cmd.
+func addReportFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&reportPath, "report", "", "Write a JSON run report to this file")
+	cmd.Flags().StringVar(&junitPath, "junit", "", "Write a JUnit XML report with one test case per module to this file")
+	cmd.Flags().StringVar(&markdownPath, "markdown", "", "Write a Markdown report for pull request comments to this file")
+	cmd.Flags().IntVar(&markdownMaxSize, "markdown-max-size", report.DefaultMarkdownMaxSize, "Maximum size of the Markdown report in bytes; the largest module outputs are truncated first (0 for no limit)")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "Output format: text, or json to print the run report to stdout and progress to stderr")
+}
+
+// moduleStatus returns the report status of a module from its run. A nil
+// run means the module never started.
+func moduleStatus(run *moduleRun) string {
+	switch {
+	case run == nil:
+		return report.StatusSkipped
+	case run.Status == report.StatusInterrupted, run.Status == report.StatusTimedOut:
+		return run.Status
+	case run.Err != nil:
+		return report.StatusFailed
+	case run.Status != "":
+		return run.Status
+	default:
+		return report.StatusSuccess
+	}
+}
+
+// buildReport collects the runs of a command into a report. Modules are
+// listed in execution order, followed by the modules left out by the
+// selection. The run fails when a module failed, timed out or was
+// interrupted. If ctx was cancelled the run is reported as interrupted, or
+// as timed out if it passed its deadline.
+func buildReport(ctx context.Context, command string, started time.Time, modules []*config.ModuleNode, runs map[string]*moduleRun, filtered []*config.ModuleNode) *report.Report {
+	finished := time.Now()
+	rep := &report.Report{
+		Version:    report.Version,
+		Command:    command,
+		Config:     configPath,
+		Status:     report.StatusSuccess,
+		StartedAt:  started.UTC(),
+		FinishedAt: finished.UTC(),
+		Duration:   finished.Sub(started).Seconds(),
+		Modules:    []report.Module{},
+	}
+
+	var total *terraform.ResourceChanges
+	for _, mod := range modules {
+		run := runs[mod.Path]
+		m := report.Module{Path: mod.Path, Status: moduleStatus(run)}
+		if run != nil {
+			m.BlockedBy = run.BlockedBy
+		}
+		if run != nil && !run.Started.IsZero() {
+			startedAt, finishedAt := run.Started.UTC(), run.Finished.UTC()
+			m.StartedAt = &startedAt
+			m.FinishedAt = &finishedAt
+			m.Duration = run.Finished.Sub(run.Started).Seconds()
+			m.Commands = run.Commands
+			m.Output = run.Output.String()
+			m.LogFile = run.LogFile
+			if run.Attempts > 1 {
+				m.Attempts = run.Attempts
+			}
+			if run.Err != nil {
+				m.Error = run.Err.Error()
+			}
+			if run.Changes != nil {
+				m.Changes = reportChanges(run.Changes)
+				if total == nil {
+					total = &terraform.ResourceChanges{}
+				}
+				*total = total.Plus(*run.Changes)
+			}
+		}
+		switch m.Status {
+		case report.StatusFailed, report.StatusTimedOut, report.StatusInterrupted:
+			rep.Status = report.StatusFailed
+		}
+		rep.Modules = append(rep.Modules, m)
+	}
+	for _, mod := range filtered {
+		rep.Modules = append(rep.Modules, report.Module{Path: mod.Path, Status: report.StatusNotSelected})
+	}
+	if total != nil {
+		rep.Changes = reportChanges(total)
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		rep.Status = report.StatusTimedOut
+	case ctx.Err() != nil:
+		rep.Status = report.StatusInterrupted
+	}
+	return rep
+}
+
+func reportChanges(c *terraform.ResourceChanges) *report.Changes {
+	return &report.Changes{
+		Add:       c.Add,
+		Change:    c.Change,
+		Destroy:   c.Destroy,
+		Resources: c.Addresses,
+	}
+}
+
+// blockedNote returns the summary note for a module skipped because a
+// module it depends on failed.
+func blockedNote(m report.Module) string {
+	if m.BlockedBy == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (blocked by failed %s)", m.BlockedBy)
+}
+
+// printModuleDetails prints the summary lines that follow a module's status:
+// the number of attempts when a step was retried and, for a module that
+// failed, its log file written with --log-dir.
+func printModuleDetails(m report.Module) {
+	if m.Attempts > 1 {
+		fmt.Fprintf(out, "    Attempts: %d\n", m.Attempts)
+	}
+	failed := m.Status == report.StatusFailed || m.Status == report.StatusTimedOut
+	if failed && m.LogFile != "" {
+		fmt.Fprintf(out, "    Log: %s\n", m.LogFile)
+	}
+}
+
+// writeReports writes rep to the --report, --junit and --markdown files
+// and, with --output json, to stdout.
+func writeReports(rep *report.Report) {
+	if reportPath != "" {
+		if err := rep.WriteJSONFile(reportPath); err != nil {
+			fmt.Fprintf(out, "Failed to write report: %v\n", err)
+		}
+	}
+	if junitPath != "" {
+		if err := rep.WriteJUnitFile(junitPath); err != nil {
+			fmt.Fprintf(out, "Failed to write JUnit report: %v\n", err)
+		}
+	}
+	if markdownPath != "" {
+		if err := rep.WriteMarkdownFile(markdownPath, markdownMaxSize); err != nil {
+			fmt.Fprintf(out, "Failed to write Markdown report: %v\n", err)
+		}
+	}
+	if outputFormat == "json" {
+		if err := rep.WriteJSON(os.Stdout); err != nil {
+			fmt.Fprintf(out, "Failed to write report: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yoohya/terracotta/config"
+	"github.com/yoohya/terracotta/report"
+	"github.com/yoohya/terracotta/terraform"
+)
+
+func TestBuildReport(t *testing.T) {
+	modules := testModules()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	runs := map[string]*moduleRun{
+		"network": {
+			Module:   modules[0],
+			Started:  start,
+			Finished: start.Add(2 * time.Second),
+			Status:   report.StatusChanges,
+			Commands: []string{"terraform init -input=false", "terraform plan -input=false -detailed-exitcode"},
+			Changes:  &terraform.ResourceChanges{Add: 2, Destroy: 1},
+		},
+		"a": {
+			Module:   modules[1],
+			Started:  start,
+			Finished: start.Add(time.Second),
+			Status:   report.StatusNoChanges,
+		},
+		"b": {
+			Module:   modules[2],
+			Started:  start,
+			Finished: start.Add(time.Second),
+			Err:      errors.New("plan failed: exit status 1"),
+		},
+		"c": {
+			Module:   modules[3],
+			Started:  start,
+			Finished: start.Add(time.Second),
+			Changes:  &terraform.ResourceChanges{Add: 1, Change: 3},
+		},
+	}
+	filtered := []*config.ModuleNode{{Path: "legacy"}}
+
+	rep := buildReport(context.Background(), "plan", start, modules, runs, filtered)
+
+	type row struct {
+		Path     string
+		Status   string
+		Error    string
+		Changes  *report.Changes
+		Duration float64
+	}
+	var got []row
+	for _, m := range rep.Modules {
+		got = append(got, row{m.Path, m.Status, m.Error, m.Changes, m.Duration})
+	}
+	want := []row{
+		{"network", report.StatusChanges, "", &report.Changes{Add: 2, Destroy: 1}, 2},
+		{"a", report.StatusNoChanges, "", nil, 1},
+		{"b", report.StatusFailed, "plan failed: exit status 1", nil, 1},
+		{"c", report.StatusSuccess, "", &report.Changes{Add: 1, Change: 3}, 1},
+		{"monitoring", report.StatusSkipped, "", nil, 0},
+		{"legacy", report.StatusNotSelected, "", nil, 0},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("modules mismatch (-want +got):\n%s", diff)
+	}
+
+	if rep.Version != report.Version || rep.Command != "plan" {
+		t.Errorf("unexpected header: version %d, command %q", rep.Version, rep.Command)
+	}
+	if rep.Status != report.StatusFailed {
+		t.Errorf("expected status %q, got %q", report.StatusFailed, rep.Status)
+	}
+	if diff := cmp.Diff(&report.Changes{Add: 3, Change: 3, Destroy: 1}, rep.Changes); diff != "" {
+		t.Errorf("total changes mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(runs["network"].Commands, rep.Modules[0].Commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildReportStatus(t *testing.T) {
+	modules := testModules()[:2]
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status string
+		err    error
+		want   string
+	}{
+		{name: "all succeeded", ctx: context.Background(), want: report.StatusSuccess},
+		{name: "module failed", ctx: context.Background(), err: errors.New("apply failed"), want: report.StatusFailed},
+		{name: "module timed out", ctx: context.Background(), status: report.StatusTimedOut, err: errors.New("module timeout of 1m0s exceeded"), want: report.StatusFailed},
+		{name: "module interrupted", ctx: context.Background(), status: report.StatusInterrupted, err: errors.New("apply failed"), want: report.StatusFailed},
+		{name: "run interrupted", ctx: cancelled, status: report.StatusInterrupted, err: errors.New("apply failed"), want: report.StatusInterrupted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			runs := map[string]*moduleRun{
+				"network": {Module: modules[0], Started: start, Finished: start},
+				"a":       {Module: modules[1], Started: start, Finished: start, Status: tt.status, Err: tt.err},
+			}
+			rep := buildReport(tt.ctx, "apply", start, modules, runs, nil)
+			if rep.Status != tt.want {
+				t.Errorf("expected status %q, got %q", tt.want, rep.Status)
+			}
+		})
+	}
+}
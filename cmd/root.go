@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -10,6 +11,12 @@ import (
 var configPath string
 var awsProfile string
 var upgradeProviders bool
+var parallelism int
+var groupOutput bool
+
+// out receives progress output and summaries. With --output json it is
+// stderr, so that stdout only carries the report.
+var out io.Writer = os.Stdout
 
 var rootCmd = &cobra.Command{
 	Use:   "terracotta",
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/yoohya/terracotta/config"
+)
+
+// prepareRun loads the config, resolves the execution order, applies the
+// selection flags and sets up the environment shared by the commands that
+// run modules. It returns the selected modules in execution order and the
+// modules left out by the selection. Any error ends the process.
+func prepareRun() (*config.Config, *config.ExecutionGraph, []*config.ModuleNode, []*config.ModuleNode) {
+	switch outputFormat {
+	case "text":
+	case "json":
+		out = os.Stderr
+	default:
+		fmt.Printf("Unknown output format %q: must be text or json\n", outputFormat)
+		os.Exit(1)
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if binaryOverride != "" {
+		cfg.Binary = binaryOverride
+	}
+	if dockerImage != "" {
+		if cfg.Docker == nil {
+			cfg.Docker = &config.Docker{}
+		}
+		cfg.Docker.Image = dockerImage
+	}
+
+	graph, err := config.BuildExecutionGraph(cfg)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to build execution graph: %v\n", err)
+		os.Exit(1)
+	}
+
+	sortedModules, err := graph.TopoSortedModules()
+	if err != nil {
+		fmt.Fprintf(out, "Failed to resolve module order: %v\n", err)
+		os.Exit(1)
+	}
+
+	selected, filtered, err := selectModules(cfg, graph, sortedModules)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to select modules: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, mod := range selected {
+		if _, err := mod.Retry.Matcher(); err != nil {
+			fmt.Fprintf(out, "Invalid retry policy for %s: %v\n", mod.Path, err)
+			os.Exit(1)
+		}
+	}
+
+	if versionsDirOverride != "" {
+		cfg.VersionsDir = versionsDirOverride
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		cfg.VersionsDir = expandHome(cfg.VersionsDir, home)
+	}
+	if cfg.VersionsDir != "" && cfg.Docker != nil {
+		fmt.Fprintln(out, "versions_dir cannot be combined with docker; the image decides the version")
+		os.Exit(1)
+	}
+
+	if cfg.Docker != nil {
+		r, err := dockerRunner(*cfg.Docker)
+		if err != nil {
+			fmt.Fprintf(out, "Failed to set up Docker execution: %v\n", err)
+			os.Exit(1)
+		}
+		runner = r
+	}
+
+	if parallelism < 1 {
+		fmt.Fprintln(out, "--parallelism must be at least 1")
+		os.Exit(1)
+	}
+
+	if awsProfile != "" {
+		if err := os.Setenv("AWS_PROFILE", awsProfile); err != nil {
+			fmt.Fprintf(out, "Warning: failed to set AWS_PROFILE: %v\n", err)
+		}
+	}
+
+	return cfg, graph, selected, filtered
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/yoohya/terracotta/config"
+)
+
+// runStateVersion is bumped whenever the run state format changes in a way
+// older versions of terracotta cannot read.
+const runStateVersion = 1
+
+// Module statuses recorded in a run state.
+const (
+	statePending = "pending"
+	stateApplied = "applied"
+	stateFailed  = "failed"
+)
+
+// runState records the progress of an apply run, so that a run that failed
+// part of the way through can be resumed with apply --resume.
+type runState struct {
+	Version    int           `json:"version"`
+	RunID      string        `json:"run_id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	Config     string        `json:"config"`
+	ConfigHash string        `json:"config_hash"`
+	BasePath   string        `json:"base_path"`
+	FromPlan   string        `json:"from_plan,omitempty"`
+	Modules    []stateModule `json:"modules"`
+
+	mu   sync.Mutex
+	path string
+}
+
+type stateModule struct {
+	Path string `json:"path"`
+	// DependsOn is the module's depends_on list when the run started.
+	DependsOn []string `json:"depends_on,omitempty"`
+	Status    string   `json:"status"`
+}
+
+// runStateDir returns the directory run states are kept in, next to the
+// config file.
+func runStateDir(cfgPath string) string {
+	return filepath.Join(filepath.Dir(cfgPath), ".terracotta", "runs")
+}
+
+// newRunID returns a run ID that sorts by start time.
+func newRunID(now time.Time) string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return now.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// newRunState returns the state of a new run of modules, all of them
+// pending. It is not saved until save or record is called.
+func newRunState(cfgPath string, cfg *config.Config, modules []*config.ModuleNode) (*runState, error) {
+	hash, err := hashFile(cfgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	s := &runState{
+		Version:    runStateVersion,
+		RunID:      newRunID(now),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Config:     cfgPath,
+		ConfigHash: hash,
+		BasePath:   cfg.BasePath,
+		Modules:    []stateModule{},
+	}
+	s.path = filepath.Join(runStateDir(cfgPath), s.RunID+".json")
+	for _, mod := range modules {
+		s.Modules = append(s.Modules, stateModule{Path: mod.Path, DependsOn: mod.DependsOn, Status: statePending})
+	}
+	return s, nil
+}
+
+func loadRunState(cfgPath, runID string) (*runState, error) {
+	path := filepath.Join(runStateDir(cfgPath), runID+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s runState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid run state: %w", err)
+	}
+	if s.Version != runStateVersion {
+		return nil, fmt.Errorf("unsupported run state version %d", s.Version)
+	}
+	s.path = path
+	return &s, nil
+}
+
+// record sets the status of a module and saves the state. It is safe to
+// call from several modules at once.
+func (s *runState) record(modulePath, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.Modules {
+		if s.Modules[i].Path == modulePath {
+			s.Modules[i].Status = status
+		}
+	}
+	s.UpdatedAt = time.Now().UTC()
+	return s.save()
+}
+
+// save writes the state to a temporary file first, so that an interrupted
+// write never leaves a truncated state behind.
+func (s *runState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// statuses returns the recorded status of each module by path.
+func (s *runState) statuses() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make(map[string]string, len(s.Modules))
+	for _, mod := range s.Modules {
+		statuses[mod.Path] = mod.Status
+	}
+	return statuses
+}
+
+// checkResume verifies that the run in s can be resumed with the current
+// config. Resuming is refused if base_path changed, if an applied module
+// was removed or its dependencies changed, since it might then have been
+// applied before a module it now depends on, if a module still to be
+// applied was removed, or if it now depends on a module outside the run.
+func checkResume(s *runState, cfg *config.Config, graph *config.ExecutionGraph) error {
+	if s.BasePath != cfg.BasePath {
+		return fmt.Errorf("base_path changed from %s to %s", s.BasePath, cfg.BasePath)
+	}
+
+	inRun := make(map[string]bool, len(s.Modules))
+	for _, mod := range s.Modules {
+		inRun[mod.Path] = true
+	}
+	for _, mod := range s.Modules {
+		node, ok := graph.Nodes[mod.Path]
+		if !ok {
+			if mod.Status == stateApplied {
+				return fmt.Errorf("applied module %s was removed from the config", mod.Path)
+			}
+			return fmt.Errorf("module %s was removed from the config", mod.Path)
+		}
+		if mod.Status == stateApplied && !config.SameSet(mod.DependsOn, node.DependsOn) {
+			return fmt.Errorf("dependencies of applied module %s changed", mod.Path)
+		}
+		for _, dep := range node.DependsOn {
+			if !inRun[dep] && !slices.Contains(mod.DependsOn, dep) {
+				return fmt.Errorf("module %s now depends on %s, which is not part of the run", mod.Path, dep)
+			}
+		}
+	}
+	return nil
+}
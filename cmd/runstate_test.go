@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yoohya/terracotta/config"
+)
+
+func TestRunStateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "terracotta.yaml")
+	writeFile(t, cfgPath, "base_path: envs/dev\n")
+	cfg := &config.Config{BasePath: "envs/dev"}
+	modules := []*config.ModuleNode{
+		{Path: "network"},
+		{Path: "app", DependsOn: []string{"network"}},
+	}
+
+	s, err := newRunState(cfgPath, cfg, modules)
+	if err != nil {
+		t.Fatalf("failed to create run state: %v", err)
+	}
+	if err := s.save(); err != nil {
+		t.Fatalf("failed to save run state: %v", err)
+	}
+	if err := s.record("network", stateApplied); err != nil {
+		t.Fatalf("failed to record status: %v", err)
+	}
+	if err := s.record("app", stateFailed); err != nil {
+		t.Fatalf("failed to record status: %v", err)
+	}
+
+	got, err := loadRunState(cfgPath, s.RunID)
+	if err != nil {
+		t.Fatalf("failed to load run state: %v", err)
+	}
+	want := map[string]string{"network": stateApplied, "app": stateFailed}
+	if diff := cmp.Diff(want, got.statuses()); diff != "" {
+		t.Errorf("statuses mismatch (-want +got):\n%s", diff)
+	}
+	if got.ConfigHash != s.ConfigHash || got.BasePath != "envs/dev" {
+		t.Errorf("unexpected run state: %+v", got)
+	}
+
+	if _, err := loadRunState(cfgPath, "missing"); err == nil {
+		t.Error("expected an error for a missing run state")
+	}
+}
+
+func TestCheckResume(t *testing.T) {
+	run := []stateModule{
+		{Path: "shared/network", Status: stateApplied},
+		{Path: "app/backend", DependsOn: []string{"shared/network"}, Status: stateApplied},
+		{Path: "shared/monitoring", DependsOn: []string{"app/backend"}, Status: stateFailed},
+		{Path: "shared/dns", Status: statePending},
+	}
+
+	tests := []struct {
+		name     string
+		basePath string
+		modules  []config.Module
+		wantErr  string
+	}{
+		{
+			name: "unchanged",
+			modules: []config.Module{
+				{Path: "shared/network"},
+				{Path: "app/backend", DependsOn: []string{"shared/network"}},
+				{Path: "shared/monitoring", DependsOn: []string{"app/backend"}},
+				{Path: "shared/dns"},
+			},
+		},
+		{
+			name: "new module outside the run",
+			modules: []config.Module{
+				{Path: "shared/network"},
+				{Path: "app/backend", DependsOn: []string{"shared/network"}},
+				{Path: "shared/monitoring", DependsOn: []string{"app/backend"}},
+				{Path: "shared/dns"},
+				{Path: "app/frontend", DependsOn: []string{"app/backend"}},
+			},
+		},
+		{
+			name: "failed module gains a dependency in the run",
+			modules: []config.Module{
+				{Path: "shared/network"},
+				{Path: "app/backend", DependsOn: []string{"shared/network"}},
+				{Path: "shared/monitoring", DependsOn: []string{"app/backend", "shared/network"}},
+				{Path: "shared/dns"},
+			},
+		},
+		{
+			name:     "base path changed",
+			basePath: "envs/prod",
+			modules: []config.Module{
+				{Path: "shared/network"},
+				{Path: "app/backend", DependsOn: []string{"shared/network"}},
+				{Path: "shared/monitoring", DependsOn: []string{"app/backend"}},
+				{Path: "shared/dns"},
+			},
+			wantErr: "base_path changed",
+		},
+		{
+			name: "applied module removed",
+			modules: []config.Module{
+				{Path: "shared/network"},
+				{Path: "shared/monitoring"},
+				{Path: "shared/dns"},
+			},
+			wantErr: "applied module app/backend was removed",
+		},
+		{
+			name: "pending module removed",
+			modules: []config.Module{
+				{Path: "shared/network"},
+				{Path: "app/backend", DependsOn: []string{"shared/network"}},
+				{Path: "shared/monitoring", DependsOn: []string{"app/backend"}},
+			},
+			wantErr: "module shared/dns was removed",
+		},
+		{
+			name: "applied module gains a dependency",
+			modules: []config.Module{
+				{Path: "shared/network"},
+				{Path: "app/backend", DependsOn: []string{"shared/network", "shared/dns"}},
+				{Path: "shared/monitoring", DependsOn: []string{"app/backend"}},
+				{Path: "shared/dns"},
+			},
+			wantErr: "dependencies of applied module app/backend changed",
+		},
+		{
+			name: "pending module depends on a module outside the run",
+			modules: []config.Module{
+				{Path: "shared/network"},
+				{Path: "app/backend", DependsOn: []string{"shared/network"}},
+				{Path: "shared/monitoring", DependsOn: []string{"app/backend"}},
+				{Path: "shared/dns", DependsOn: []string{"shared/registrar"}},
+				{Path: "shared/registrar"},
+			},
+			wantErr: "module shared/dns now depends on shared/registrar",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			basePath := tt.basePath
+			if basePath == "" {
+				basePath = "envs/dev"
+			}
+			cfg := &config.Config{BasePath: basePath, Modules: tt.modules}
+			graph, err := config.BuildExecutionGraph(cfg)
+			if err != nil {
+				t.Fatalf("failed to build graph: %v", err)
+			}
+
+			s := &runState{BasePath: "envs/dev", Modules: run}
+			err = checkResume(s, cfg, graph)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
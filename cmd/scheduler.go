@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/yoohya/terracotta/config"
+	"github.com/yoohya/terracotta/report"
+	"github.com/yoohya/terracotta/terraform"
+)
+
+// runner runs terraform for every module. Tests replace it with a
+// terraform.FakeRunner.
+var runner terraform.Runner = terraform.ExecRunner{}
+
+// moduleRun records what happened while running one module. A task only
+// touches its own moduleRun, so no locking is needed.
+type moduleRun struct {
+	Module *config.ModuleNode
+	// Out receives the module's output.
+	Out      io.Writer
+	Started  time.Time
+	Finished time.Time
+	// Status is set by the task when the module did not simply succeed,
+	// e.g. report.StatusNoChanges. Failures are recorded in Err instead.
+	Status   string
+	Err      error
+	Commands []string
+	Changes  *terraform.ResourceChanges
+	// Output holds a copy of everything written to Out, for the reports.
+	Output bytes.Buffer
+	// LogFile is the last log file written with --log-dir.
+	LogFile string
+	logged  map[string]bool
+	// Attempts is the largest number of attempts any step of the module
+	// took.
+	Attempts int
+	// BlockedBy is the failed module that kept this one from starting
+	// under the skip-dependents failure policy.
+	BlockedBy string
+}
+
+// run runs terraform with args in modulePath, writing its output to r.Out
+// and recording the command line. A step that fails with output matching
+// the module's retry policy is run again after a backoff.
+func (r *moduleRun) run(ctx context.Context, modulePath string, args ...string) error {
+	r.Commands = append(r.Commands, commandLine(r.Module.Binary, args))
+	policy := r.Module.Retry
+	for attempt := 1; ; attempt++ {
+		r.Attempts = max(r.Attempts, attempt)
+		output, err := r.runOnce(ctx, modulePath, args...)
+		if err == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || !retryable(policy, args, output, err) {
+			return err
+		}
+
+		delay := policy.Delay(attempt)
+		fmt.Fprintf(r.Out, "[%s] %s failed with a retryable error, retrying in %s (attempt %d of %d)\n", r.Module.Path, args[0], delay, attempt+1, policy.MaxAttempts)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// runOnce runs terraform once and returns its output. With --log-dir the
+// output is also written to a log file named after the step.
+func (r *moduleRun) runOnce(ctx context.Context, modulePath string, args ...string) ([]byte, error) {
+	inv := terraform.Invocation{Command: r.Module.Binary, Dir: modulePath, Args: args}
+	if logDir == "" {
+		return terraform.Stream(ctx, runner, r.Out, r.Module.Path, inv)
+	}
+
+	log, err := r.openLog(args[0])
+	if err != nil {
+		fmt.Fprintf(r.Out, "[%s] Warning: failed to open log file: %v\n", r.Module.Path, err)
+		return terraform.Stream(ctx, runner, r.Out, r.Module.Path, inv)
+	}
+	output, err := terraform.Stream(ctx, runner, io.MultiWriter(r.Out, log), r.Module.Path, inv)
+	if err != nil && !planChanged(args, err) {
+		fmt.Fprintf(log, "[%s] Failed: %v\n", r.Module.Path, err)
+	}
+	if cerr := log.Close(); cerr != nil {
+		fmt.Fprintf(r.Out, "[%s] Warning: failed to write log file: %v\n", r.Module.Path, cerr)
+	}
+	return output, err
+}
+
+// retryable reports whether a step that failed with err and output may be
+// retried under policy. A plan that exits with status 2 has changes rather
+// than an error and is never retried.
+func retryable(policy config.Retry, args []string, output []byte, err error) bool {
+	if !policy.Enabled() {
+		return false
+	}
+	if planChanged(args, err) {
+		return false
+	}
+	re, err := policy.Matcher()
+	return err == nil && re.Match(output)
+}
+
+// planChanged reports whether err only tells that the plan step run with
+// args found changes, which -detailed-exitcode reports as exit status 2.
+func planChanged(args []string, err error) bool {
+	if args[0] != "plan" {
+		return false
+	}
+	changes, _ := terraform.PlanChanges(err)
+	return changes
+}
+
+// failurePolicy decides what happens to the remaining modules when a module
+// fails.
+type failurePolicy string
+
+const (
+	// failureStop starts no new module after the first failure.
+	failureStop failurePolicy = "stop"
+	// failureContinue runs every module, even if its dependencies failed.
+	failureContinue failurePolicy = "continue"
+	// failureSkipDependents skips the modules downstream of a failed
+	// module and runs all others.
+	failureSkipDependents failurePolicy = "skip-dependents"
+)
+
+func parseFailurePolicy(s string) (failurePolicy, error) {
+	switch p := failurePolicy(s); p {
+	case failureStop, failureContinue, failureSkipDependents:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown failure policy %q: must be stop, continue or skip-dependents", s)
+}
+
+// moduleTask runs a single module.
+type moduleTask func(ctx context.Context, run *moduleRun) error
+
+// outMu serializes writes of module output to out when modules run in
+// parallel.
+var outMu sync.Mutex
+
+// lockedWriter writes to w while holding mu. Module output is written one
+// line per Write, so concurrent modules interleave only between lines.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// runGraph runs task for every module, starting a module as soon as all of
+// its dependencies within modules have finished. At most parallelism tasks run
+// at the same time, and onFailure decides which modules still run after a
+// failure. Once ctx is cancelled no new module is started and the running
+// ones are passed the cancellation. The returned map holds the run of every
+// module that was started and of every module skipped because a module it
+// depends on failed, with BlockedBy set; other modules that never started
+// are absent.
+func runGraph(ctx context.Context, modules []*config.ModuleNode, parallelism int, onFailure failurePolicy, task moduleTask) map[string]*moduleRun {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	index := make(map[string]int, len(modules))
+	for i, mod := range modules {
+		index[mod.Path] = i
+	}
+
+	pending := make(map[string]int, len(modules))
+	dependents := make(map[string][]*config.ModuleNode)
+	var ready []*config.ModuleNode
+	for _, mod := range modules {
+		for _, dep := range mod.DependsOn {
+			if _, ok := index[dep]; ok {
+				pending[mod.Path]++
+				dependents[dep] = append(dependents[dep], mod)
+			}
+		}
+		if pending[mod.Path] == 0 {
+			ready = append(ready, mod)
+		}
+	}
+
+	finished := make(chan *moduleRun)
+	results := make(map[string]*moduleRun, len(modules))
+	running := 0
+	failed := false
+
+	for {
+		for running < parallelism && len(ready) > 0 && !(onFailure == failureStop && failed) && ctx.Err() == nil {
+			mod := ready[0]
+			ready = ready[1:]
+			running++
+			run := &moduleRun{Module: mod}
+			results[mod.Path] = run
+			go func() {
+				runTask(ctx, run, parallelism > 1, task)
+				finished <- run
+			}()
+		}
+		if running == 0 {
+			break
+		}
+
+		run := <-finished
+		running--
+		if run.Err != nil {
+			failed = true
+			if onFailure == failureSkipDependents {
+				blockDependents(run.Module, dependents, results)
+			}
+		}
+		for _, next := range dependents[run.Module.Path] {
+			pending[next.Path]--
+			if pending[next.Path] == 0 && results[next.Path] == nil {
+				ready = insertByIndex(ready, next, index)
+			}
+		}
+	}
+
+	return results
+}
+
+// blockDependents records every module downstream of the failed module as
+// skipped and blocked by it, unless it already has a result.
+func blockDependents(failed *config.ModuleNode, dependents map[string][]*config.ModuleNode, results map[string]*moduleRun) {
+	queue := dependents[failed.Path]
+	for len(queue) > 0 {
+		mod := queue[0]
+		queue = queue[1:]
+		if results[mod.Path] != nil {
+			continue
+		}
+		results[mod.Path] = &moduleRun{Module: mod, Status: report.StatusSkipped, BlockedBy: failed.Path}
+		queue = append(queue, dependents[mod.Path]...)
+	}
+}
+
+// runTask runs task for run and records its timing, error and output. The
+// module's timeout, if any, applies to the whole task. A module that fails
+// after ctx was cancelled is marked as interrupted, or as timed out if the
+// run or the module passed its deadline. When modules run in parallel their
+// output is still printed line by line as it is written, unless
+// --group-output is set: then the module's output is collected and written
+// to out in one block once the task returns.
+func runTask(ctx context.Context, run *moduleRun, parallel bool, task moduleTask) {
+	var buf bytes.Buffer
+	buffered := parallel && groupOutput
+	switch {
+	case buffered:
+		run.Out = io.MultiWriter(&buf, &run.Output)
+	case parallel:
+		run.Out = io.MultiWriter(lockedWriter{mu: &outMu, w: out}, &run.Output)
+	default:
+		run.Out = io.MultiWriter(out, &run.Output)
+	}
+
+	taskCtx := ctx
+	if timeout := run.Module.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		taskCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	run.Started = time.Now()
+	run.Err = task(taskCtx, run)
+	run.Finished = time.Now()
+	if run.Err != nil {
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			run.Status = report.StatusTimedOut
+			run.Err = fmt.Errorf("run timeout exceeded: %w", run.Err)
+		case errors.Is(taskCtx.Err(), context.DeadlineExceeded):
+			run.Status = report.StatusTimedOut
+			run.Err = fmt.Errorf("module timeout of %s exceeded: %w", run.Module.Timeout, run.Err)
+		case ctx.Err() != nil:
+			run.Status = report.StatusInterrupted
+		}
+	}
+
+	if buffered {
+		outMu.Lock()
+		defer outMu.Unlock()
+		_, _ = buf.WriteTo(out)
+	}
+}
+
+// insertByIndex inserts mod into ready, keeping it ordered by position in the
+// original module list.
+func insertByIndex(ready []*config.ModuleNode, mod *config.ModuleNode, index map[string]int) []*config.ModuleNode {
+	i := len(ready)
+	for i > 0 && index[ready[i-1].Path] > index[mod.Path] {
+		i--
+	}
+	ready = append(ready, nil)
+	copy(ready[i+1:], ready[i:])
+	ready[i] = mod
+	return ready
+}
+
+// reverseModules returns copies of modules in reverse order in which
+// DependsOn lists each module's dependents instead of its dependencies.
+// Running them with runGraph handles every module only after all modules
+// that depend on it, which is the order destroy needs.
+func reverseModules(modules []*config.ModuleNode) []*config.ModuleNode {
+	dependents := make(map[string][]string)
+	for _, mod := range modules {
+		for _, dep := range mod.DependsOn {
+			dependents[dep] = append(dependents[dep], mod.Path)
+		}
+	}
+
+	reversed := make([]*config.ModuleNode, 0, len(modules))
+	for i := len(modules) - 1; i >= 0; i-- {
+		node := *modules[i]
+		node.DependsOn = dependents[node.Path]
+		reversed = append(reversed, &node)
+	}
+	return reversed
+}
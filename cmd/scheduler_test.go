@@ -0,0 +1,394 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yoohya/terracotta/config"
+	"github.com/yoohya/terracotta/report"
+	"github.com/yoohya/terracotta/terraform"
+)
+
+func testModules() []*config.ModuleNode {
+	return []*config.ModuleNode{
+		{Path: "network"},
+		{Path: "a", DependsOn: []string{"network"}},
+		{Path: "b", DependsOn: []string{"network"}},
+		{Path: "c", DependsOn: []string{"network"}},
+		{Path: "monitoring", DependsOn: []string{"a", "b", "c"}},
+	}
+}
+
+func TestRunGraphRespectsDependencies(t *testing.T) {
+	var mu sync.Mutex
+	finished := map[string]bool{}
+
+	results := runGraph(context.Background(), testModules(), 3, failureContinue, func(ctx context.Context, run *moduleRun) error {
+		mod := run.Module
+		mu.Lock()
+		for _, dep := range mod.DependsOn {
+			if !finished[dep] {
+				t.Errorf("%s started before dependency %s finished", mod.Path, dep)
+			}
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		finished[mod.Path] = true
+		mu.Unlock()
+		return nil
+	})
+
+	if len(results) != 5 {
+		t.Errorf("expected 5 results, got %d", len(results))
+	}
+}
+
+func TestRunGraphLimitsParallelism(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+
+	runGraph(context.Background(), testModules(), 2, failureContinue, func(ctx context.Context, run *moduleRun) error {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+
+	if peak != 2 {
+		t.Errorf("expected at most 2 concurrent modules with a peak of 2, got %d", peak)
+	}
+}
+
+func TestRunGraphStopOnFailure(t *testing.T) {
+	results := runGraph(context.Background(), testModules(), 1, failureStop, func(ctx context.Context, run *moduleRun) error {
+		mod := run.Module
+		if mod.Path == "a" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	if results["a"].Err == nil {
+		t.Error("expected module a to fail")
+	}
+	for _, path := range []string{"b", "c", "monitoring"} {
+		if _, ran := results[path]; ran {
+			t.Errorf("expected %s not to run after a failure", path)
+		}
+	}
+}
+
+func TestRunGraphContinueOnFailure(t *testing.T) {
+	results := runGraph(context.Background(), testModules(), 1, failureContinue, func(ctx context.Context, run *moduleRun) error {
+		mod := run.Module
+		if mod.Path == "network" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	if len(results) != 5 {
+		t.Errorf("expected all 5 modules to run, got %d", len(results))
+	}
+}
+
+func TestReverseModules(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+
+	runGraph(context.Background(), reverseModules(testModules()), 3, failureContinue, func(ctx context.Context, run *moduleRun) error {
+		mod := run.Module
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, mod.Path)
+		return nil
+	})
+
+	position := map[string]int{}
+	for i, path := range order {
+		position[path] = i
+	}
+	for _, mod := range testModules() {
+		for _, dep := range mod.DependsOn {
+			if position[mod.Path] > position[dep] {
+				t.Errorf("%s should run before its dependency %s, got order %v", mod.Path, dep, order)
+			}
+		}
+	}
+}
+
+func TestRunGraphCapturesOutput(t *testing.T) {
+	saved := out
+	defer func() { out = saved }()
+	var printed bytes.Buffer
+	out = &printed
+
+	results := runGraph(context.Background(), testModules(), 2, failureContinue, func(ctx context.Context, run *moduleRun) error {
+		fmt.Fprintf(run.Out, "[%s] done\n", run.Module.Path)
+		return nil
+	})
+
+	for _, mod := range testModules() {
+		want := fmt.Sprintf("[%s] done\n", mod.Path)
+		if got := results[mod.Path].Output.String(); got != want {
+			t.Errorf("expected %s output %q, got %q", mod.Path, want, got)
+		}
+		if !strings.Contains(printed.String(), want) {
+			t.Errorf("expected %q to be printed", want)
+		}
+	}
+}
+
+func TestRunGraphParallelOutput(t *testing.T) {
+	saved, savedGroup := out, groupOutput
+	defer func() { out, groupOutput = saved, savedGroup }()
+
+	for _, tt := range []struct {
+		name        string
+		group       bool
+		wantRunning bool
+	}{
+		{name: "streamed", wantRunning: true},
+		{name: "grouped", group: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var printed bytes.Buffer
+			out, groupOutput = &printed, tt.group
+
+			runGraph(context.Background(), testModules(), 2, failureContinue, func(ctx context.Context, run *moduleRun) error {
+				line := fmt.Sprintf("[%s] still creating\n", run.Module.Path)
+				fmt.Fprint(run.Out, line)
+
+				outMu.Lock()
+				shown := strings.Contains(printed.String(), line)
+				outMu.Unlock()
+				if shown != tt.wantRunning {
+					t.Errorf("expected %s output printed while running to be %v, got %v", run.Module.Path, tt.wantRunning, shown)
+				}
+				return nil
+			})
+
+			for _, mod := range testModules() {
+				if want := fmt.Sprintf("[%s] still creating\n", mod.Path); !strings.Contains(printed.String(), want) {
+					t.Errorf("expected %q to be printed", want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunGraphStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := runGraph(ctx, testModules(), 1, failureContinue, func(ctx context.Context, run *moduleRun) error {
+		if run.Module.Path == "network" {
+			cancel()
+			<-ctx.Done()
+			return errors.New("terraform stopped")
+		}
+		return nil
+	})
+
+	if len(results) != 1 {
+		t.Errorf("expected only network to run, got %d modules", len(results))
+	}
+	if got := moduleStatus(results["network"]); got != report.StatusInterrupted {
+		t.Errorf("expected network to be %s, got %s", report.StatusInterrupted, got)
+	}
+}
+
+func TestRunGraphTimeouts(t *testing.T) {
+	modules := testModules()
+	modules[1].Timeout = 10 * time.Millisecond
+
+	wait := func(ctx context.Context, run *moduleRun) error {
+		if run.Module.Path == "a" || run.Module.Path == "b" {
+			<-ctx.Done()
+			return errors.New("terraform stopped")
+		}
+		return nil
+	}
+
+	t.Run("module timeout", func(t *testing.T) {
+		results := runGraph(context.Background(), modules, 2, failureContinue, func(ctx context.Context, run *moduleRun) error {
+			if run.Module.Path == "b" {
+				// Without a timeout b would wait forever.
+				return nil
+			}
+			return wait(ctx, run)
+		})
+
+		if got := moduleStatus(results["a"]); got != report.StatusTimedOut {
+			t.Errorf("expected a to be %s, got %s", report.StatusTimedOut, got)
+		}
+		if want := "module timeout of 10ms exceeded: terraform stopped"; results["a"].Err.Error() != want {
+			t.Errorf("expected error %q, got %q", want, results["a"].Err)
+		}
+		if got := moduleStatus(results["monitoring"]); got != report.StatusSuccess {
+			t.Errorf("expected the other modules to keep running, got monitoring %s", got)
+		}
+	})
+
+	t.Run("run timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		results := runGraph(ctx, testModules(), 2, failureContinue, wait)
+
+		if got := moduleStatus(results["b"]); got != report.StatusTimedOut {
+			t.Errorf("expected b to be %s, got %s", report.StatusTimedOut, got)
+		}
+		if _, ran := results["monitoring"]; ran {
+			t.Error("expected no module to start after the run timeout")
+		}
+	})
+}
+
+func TestModuleRunRetries(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh not available")
+	}
+	bin := t.TempDir()
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// The fake terraform fails with $FAIL_OUTPUT until it has run
+	// $FAIL_TIMES times, then prints it and exits with $EXIT_CODE.
+	writeFile(t, filepath.Join(bin, "terraform"), `#!/bin/sh
+count=$(cat count 2>/dev/null || echo 0)
+count=$((count+1))
+echo $count > count
+if [ $count -le $FAIL_TIMES ]; then
+  echo "$FAIL_OUTPUT" >&2
+  exit 1
+fi
+echo "$FAIL_OUTPUT"
+exit ${EXIT_CODE:-0}
+`)
+	if err := os.Chmod(filepath.Join(bin, "terraform"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := config.Retry{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond, Patterns: []string{"state lock"}}
+	tests := []struct {
+		name         string
+		args         []string
+		failTimes    string
+		failOutput   string
+		exitCode     string
+		wantAttempts int
+		wantError    bool
+	}{
+		{name: "succeeds after retries", args: []string{"init"}, failTimes: "2", failOutput: "Error acquiring the state lock", wantAttempts: 3},
+		{name: "gives up after max attempts", args: []string{"apply"}, failTimes: "5", failOutput: "Error acquiring the state lock", wantAttempts: 3, wantError: true},
+		{name: "other errors are not retried", args: []string{"apply"}, failTimes: "5", failOutput: "Error: invalid reference", wantAttempts: 1, wantError: true},
+		{name: "plan with changes is not retried", args: []string{"plan", "-detailed-exitcode"}, failOutput: "~ description = \"state lock table\"", exitCode: "2", wantAttempts: 1, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FAIL_TIMES", cmp.Or(tt.failTimes, "0"))
+			t.Setenv("FAIL_OUTPUT", tt.failOutput)
+			t.Setenv("EXIT_CODE", tt.exitCode)
+
+			run := &moduleRun{
+				Module: &config.ModuleNode{Path: "a", Retry: policy},
+				Out:    io.Discard,
+			}
+			err := run.run(context.Background(), t.TempDir(), tt.args...)
+			if (err != nil) != tt.wantError {
+				t.Errorf("expected error=%v, got %v", tt.wantError, err)
+			}
+			if run.Attempts != tt.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.wantAttempts, run.Attempts)
+			}
+		})
+	}
+}
+
+func TestRunGraphSkipDependents(t *testing.T) {
+	modules := append(testModules(), &config.ModuleNode{Path: "dashboard", DependsOn: []string{"monitoring"}}, &config.ModuleNode{Path: "dns"})
+
+	results := runGraph(context.Background(), modules, 2, failureSkipDependents, func(ctx context.Context, run *moduleRun) error {
+		if run.Module.Path == "a" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	want := map[string]string{
+		"network":    report.StatusSuccess,
+		"a":          report.StatusFailed,
+		"b":          report.StatusSuccess,
+		"c":          report.StatusSuccess,
+		"monitoring": report.StatusSkipped,
+		"dashboard":  report.StatusSkipped,
+		"dns":        report.StatusSuccess,
+	}
+	for path, status := range want {
+		if got := moduleStatus(results[path]); got != status {
+			t.Errorf("expected %s to be %s, got %s", path, status, got)
+		}
+	}
+	for _, path := range []string{"monitoring", "dashboard"} {
+		if results[path].BlockedBy != "a" {
+			t.Errorf("expected %s to be blocked by a, got %q", path, results[path].BlockedBy)
+		}
+		if !results[path].Started.IsZero() {
+			t.Errorf("expected %s not to start", path)
+		}
+	}
+}
+
+func TestParseFailurePolicy(t *testing.T) {
+	for _, s := range []string{"stop", "continue", "skip-dependents"} {
+		if p, err := parseFailurePolicy(s); err != nil || string(p) != s {
+			t.Errorf("parseFailurePolicy(%q) = %q, %v", s, p, err)
+		}
+	}
+	if _, err := parseFailurePolicy("ignore"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+// useFakeRunner makes the commands run terraform with a fake runner, and
+// discards their output, for the rest of the test.
+func useFakeRunner(t *testing.T) *terraform.FakeRunner {
+	t.Helper()
+	savedRunner, savedOut := runner, out
+	t.Cleanup(func() { runner, out = savedRunner, savedOut })
+
+	fake := &terraform.FakeRunner{}
+	runner, out = fake, io.Discard
+	return fake
+}
+
+// fakeSteps lists the calls made to fake as "<dir> <step>".
+func fakeSteps(fake *terraform.FakeRunner) []string {
+	var steps []string
+	for _, c := range fake.Calls() {
+		steps = append(steps, filepath.ToSlash(c.Dir)+" "+c.Step())
+	}
+	return steps
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/yoohya/terracotta/config"
+)
+
+var targets []string
+var excludes []string
+var withDependencies bool
+var withDependents bool
+var tagsExpr string
+var skipTagsExpr string
+
+// addSelectionFlags registers the module selection flags on cmd.
+func addSelectionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&targets, "target", nil, "Only run modules matching this path or glob (repeatable)")
+	cmd.Flags().StringArrayVar(&excludes, "exclude", nil, "Leave out modules matching this path or glob (repeatable)")
+	cmd.Flags().StringVar(&tagsExpr, "tags", "", "Only run modules whose tags match this expression, e.g. \"networking,data\" or \"app and not legacy\"")
+	cmd.Flags().StringVar(&skipTagsExpr, "skip-tags", "", "Leave out modules whose tags match this expression")
+	cmd.Flags().StringVar(&changedSince, "changed-since", "", "Only run modules changed since this git ref, plus everything downstream of them")
+	cmd.Flags().BoolVar(&withDependencies, "with-dependencies", false, "Also run every module the selected modules depend on")
+	cmd.Flags().BoolVar(&withDependents, "with-dependents", false, "Also run every module that depends on the selected modules")
+}
+
+// selectionFlagsChanged reports whether any module selection flag was set on
+// the command line.
+func selectionFlagsChanged(cmd *cobra.Command) bool {
+	for _, name := range []string{"target", "exclude", "tags", "skip-tags", "changed-since", "with-dependencies", "with-dependents"} {
+		if cmd.Flags().Changed(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectModules splits sorted into the modules chosen by the selection flags
+// and the modules left out by them. Both keep the order of sorted.
+func selectModules(cfg *config.Config, graph *config.ExecutionGraph, sorted []*config.ModuleNode) ([]*config.ModuleNode, []*config.ModuleNode, error) {
+	selector := config.Selector{
+		Targets:          targets,
+		Excludes:         excludes,
+		WithDependencies: withDependencies,
+		WithDependents:   withDependents,
+	}
+	if tagsExpr != "" {
+		expr, err := config.ParseTagExpr(tagsExpr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --tags: %w", err)
+		}
+		selector.Tags = expr
+	}
+	if skipTagsExpr != "" {
+		expr, err := config.ParseTagExpr(skipTagsExpr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --skip-tags: %w", err)
+		}
+		selector.SkipTags = expr
+	}
+
+	if changedSince != "" {
+		changed, err := changedModules(cfg, graph, configPath, changedSince)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to find changes since %s: %w", changedSince, err)
+		}
+		selector.Only = changed
+	}
+
+	chosen, err := graph.Select(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var selected, filtered []*config.ModuleNode
+	for _, mod := range sorted {
+		if chosen[mod.Path] {
+			selected = append(selected, mod)
+		} else {
+			filtered = append(filtered, mod)
+		}
+	}
+	return selected, filtered, nil
+}
+
+// printFiltered lists the modules left out by the selection flags, apart
+// from the modules skipped because of failures.
+func printFiltered(filtered []*config.ModuleNode) {
+	if len(filtered) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "\nNot selected:")
+	for _, mod := range filtered {
+		fmt.Fprintf(out, "- %s\n", mod.Path)
+	}
+}
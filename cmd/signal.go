@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/yoohya/terracotta/terraform"
+)
+
+// exitInterrupted is the exit status of a run stopped by a signal, as a
+// shell reports for SIGINT.
+const exitInterrupted = 130
+
+var runTimeout time.Duration
+
+// runContext returns a context that is cancelled by the first SIGINT or
+// SIGTERM, or when --timeout has passed. Cancelling it passes an interrupt
+// on to the running terraform processes, which stop cleanly, and no new
+// module is started. A second signal kills terraform, as does the end of a
+// grace period after the timeout.
+func runContext() (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if runTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), runTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Fprintf(out, "\nReceived %s: waiting for terraform to stop, no new modules will be started. Send it again to force quit.\n", sig)
+			cancel()
+		case <-ctx.Done():
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return
+			}
+			fmt.Fprintf(out, "\nRun timeout of %s exceeded: waiting for terraform to stop, no new modules will be started.\n", runTimeout)
+		}
+
+		sig := <-signals
+		fmt.Fprintf(out, "\nReceived %s: killing terraform.\n", sig)
+		terraform.KillAll()
+	}()
+
+	return ctx, cancel
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/yoohya/terracotta/config"
+)
+
+// initArgs returns the arguments for terraform init, shared by every command
+// that runs modules.
+func initArgs() []string {
+	// init コマンドの引数を構築
+	args := []string{"init", "-input=false"}
+	if upgradeProviders {
+		args = append(args, "-upgrade")
+	}
+	return args
+}
+
+// planArgs returns the arguments for terraform plan. Plans use
+// -detailed-exitcode so that modules with changes can be told apart from
+// modules without. When planFile is set the plan is saved there.
+func planArgs(planFile string) []string {
+	args := []string{"plan", "-input=false", "-detailed-exitcode"}
+	if planFile != "" {
+		args = append(args, "-out="+planFile)
+	}
+	return args
+}
+
+// applyArgs returns the arguments for terraform apply. When planFile is set
+// that saved plan is applied instead of planning again.
+func applyArgs(planFile string) []string {
+	if planFile != "" {
+		return []string{"apply", "-input=false", planFile}
+	}
+	return []string{"apply", "-auto-approve"}
+}
+
+// showArgs returns the arguments for reading a saved plan as JSON.
+func showArgs(planFile string) []string {
+	return []string{"show", "-json", planFile}
+}
+
+// destroyArgs returns the arguments for terraform destroy.
+func destroyArgs() []string {
+	return []string{"destroy", "-auto-approve"}
+}
+
+// commandLine renders binary and args as the command line shown to users.
+// An empty binary stands for terraform.
+func commandLine(binary string, args []string) string {
+	if binary == "" {
+		binary = config.DefaultBinary
+	}
+	return binary + " " + strings.Join(args, " ")
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/yoohya/terracotta/config"
+)
+
+var validateOutput string
+var validateSkipDirs bool
+
+type validateResult struct {
+	Config   string           `json:"config"`
+	Valid    bool             `json:"valid"`
+	Error    string           `json:"error,omitempty"`
+	Problems []config.Problem `json:"problems"`
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [config files...]",
+	Short: "Check config files and report every problem found",
+	Long: `Validate checks each config file for duplicate module paths, self-dependencies,
+unknown dependencies, dependency cycles, missing module directories and module
+directories without .tf files. It exits with status 1 if any problem is found.
+
+Config files can be passed as arguments, which lets validate run as a
+pre-commit hook. Without arguments the file given by --config is checked.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if validateOutput != "text" && validateOutput != "json" {
+			fmt.Printf("Unknown output format %q: must be text or json\n", validateOutput)
+			os.Exit(1)
+		}
+
+		paths := args
+		if len(paths) == 0 {
+			paths = []string{configPath}
+		}
+
+		var results []validateResult
+		valid := true
+		for _, path := range paths {
+			res := validateResult{Config: path, Problems: []config.Problem{}}
+			cfg, err := config.LoadConfig(path)
+			if err != nil {
+				res.Error = err.Error()
+			} else if validateSkipDirs {
+				res.Problems = append(res.Problems, config.ValidateGraph(cfg)...)
+			} else {
+				res.Problems = append(res.Problems, config.Validate(cfg)...)
+			}
+			res.Valid = res.Error == "" && len(res.Problems) == 0
+			valid = valid && res.Valid
+			results = append(results, res)
+		}
+
+		if validateOutput == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(results); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write result: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			for _, res := range results {
+				switch {
+				case res.Error != "":
+					fmt.Printf("✖ %s: failed to load config: %s\n", res.Config, res.Error)
+				case res.Valid:
+					fmt.Printf("✔ %s: valid\n", res.Config)
+				default:
+					fmt.Printf("✖ %s: %d problem(s) found\n", res.Config, len(res.Problems))
+					for _, p := range res.Problems {
+						fmt.Printf("    [%s] %s\n", p.Kind, p.Message)
+					}
+				}
+			}
+		}
+
+		if !valid {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().StringVarP(&configPath, "config", "c", "terracotta.yaml", "Path to config file")
+	validateCmd.Flags().StringVarP(&validateOutput, "output", "o", "text", "Output format: text or json")
+	validateCmd.Flags().BoolVar(&validateSkipDirs, "skip-dirs", false, "Skip checks of module directories under base_path")
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"cmp"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ModulesForFiles returns the modules, in config order, whose directory
+// under BasePath contains at least one of files. Relative files and a
+// relative BasePath are taken from the working directory, and both sides are
+// compared as absolute paths with symlinks resolved. When module directories
+// are nested, a file belongs only to the most specific module.
+func (c *Config) ModulesForFiles(files []string) []string {
+	dirs := make(map[string]string, len(c.Modules))
+	for _, mod := range c.Modules {
+		dirs[mod.Path] = ResolvePath(filepath.Join(c.BasePath, mod.Path))
+	}
+
+	hit := make(map[string]bool)
+	for _, file := range files {
+		file = ResolvePath(file)
+		owner, longest := "", -1
+		for _, mod := range c.Modules {
+			dir := dirs[mod.Path]
+			if (file == dir || strings.HasPrefix(file, dir+string(filepath.Separator))) && len(dir) > longest {
+				owner, longest = mod.Path, len(dir)
+			}
+		}
+		if longest >= 0 {
+			hit[owner] = true
+		}
+	}
+
+	var paths []string
+	for _, mod := range c.Modules {
+		if hit[mod.Path] {
+			paths = append(paths, mod.Path)
+			delete(hit, mod.Path)
+		}
+	}
+	return paths
+}
+
+// ResolvePath makes path absolute and resolves the symlinks in it, so paths
+// reached through different links can be compared. The part of path that
+// does not exist, such as a deleted file, is kept as it is.
+func ResolvePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.Clean(path)
+	for dir, rest := path, ""; ; {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return path
+		}
+		dir, rest = parent, filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// ChangedModules compares an earlier version of a config with c and returns
+// the modules of c, in config order, that are new or whose definition
+// changed, such as a new dependency edge. A module also changed when the
+// binary, retry policy or version constraint it inherits from the top of the
+// config changed. Changes to tags alone are ignored since they do not affect
+// what terraform runs. If old is nil or BasePath changed, every module is
+// returned.
+func (c *Config) ChangedModules(old *Config) []string {
+	var paths []string
+	if old == nil || filepath.Clean(old.BasePath) != filepath.Clean(c.BasePath) {
+		for _, mod := range c.Modules {
+			paths = append(paths, mod.Path)
+		}
+		return paths
+	}
+
+	before := make(map[string]Module, len(old.Modules))
+	for _, mod := range old.Modules {
+		before[mod.Path] = mod
+	}
+	for _, mod := range c.Modules {
+		prev, exists := before[mod.Path]
+		if !exists || !sameDefinition(prev, mod) || !sameInherited(old, c, prev, mod) {
+			paths = append(paths, mod.Path)
+		}
+	}
+	return paths
+}
+
+// sameDefinition reports whether two versions of a module would run the same
+// way. The order of dependencies and tags do not matter.
+func sameDefinition(a, b Module) bool {
+	a.Tags, b.Tags = nil, nil
+	if !SameSet(a.DependsOn, b.DependsOn) {
+		return false
+	}
+	a.DependsOn, b.DependsOn = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// sameInherited reports whether mod in c runs with the same binary, retry
+// policy and version constraint as prev did in old, taking the defaults at
+// the top of each config into account.
+func sameInherited(old, c *Config, prev, mod Module) bool {
+	return old.binaryFor(prev) == c.binaryFor(mod) &&
+		reflect.DeepEqual(old.retryFor(prev), c.retryFor(mod)) &&
+		cmp.Or(prev.RequiredVersion, old.RequiredVersion) == cmp.Or(mod.RequiredVersion, c.RequiredVersion)
+}
+
+// SameSet reports whether a and b hold the same strings, in any order and
+// ignoring duplicates.
+func SameSet(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
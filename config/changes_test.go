@@ -0,0 +1,187 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestModulesForFiles(t *testing.T) {
+	cfg := &Config{
+		BasePath: "environments/dev",
+		Modules: []Module{
+			{Path: "shared/network"},
+			{Path: "shared"},
+			{Path: "serviceA/backend"},
+			{Path: "serviceB/backend"},
+		},
+	}
+
+	files := []string{
+		filepath.FromSlash("environments/dev/serviceB/backend/main.tf"),
+		filepath.FromSlash("environments/dev/shared/network/vpc/subnets.tf"),
+		filepath.FromSlash("environments/dev/serviceA/frontend/main.tf"),
+		filepath.FromSlash("environments/prod/serviceA/backend/main.tf"),
+		filepath.FromSlash("README.md"),
+	}
+
+	got := cfg.ModulesForFiles(files)
+	want := []string{"shared/network", "serviceB/backend"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ModulesForFiles() mismatch (-want +got):\n%s", diff)
+	}
+
+	got = cfg.ModulesForFiles([]string{filepath.FromSlash("environments/dev/shared/outputs.tf")})
+	if diff := cmp.Diff([]string{"shared"}, got); diff != "" {
+		t.Errorf("ModulesForFiles() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestModulesForFilesResolvesPaths(t *testing.T) {
+	repo := t.TempDir()
+	for _, dir := range []string{"environments/dev/network", "environments/dev/db"} {
+		if err := os.MkdirAll(filepath.Join(repo, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(t.TempDir(), "dev")
+	if err := os.Symlink(filepath.Join(repo, "environments", "dev"), link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	t.Chdir(repo)
+
+	files := []string{
+		filepath.FromSlash("environments/dev/network/main.tf"),
+		// Deleted files no longer exist but still belong to their module.
+		filepath.Join(repo, "environments", "dev", "db", "removed.tf"),
+	}
+	want := []string{"network", "db"}
+
+	for name, basePath := range map[string]string{
+		"relative base_path":        filepath.FromSlash("environments/dev"),
+		"absolute base_path":        filepath.Join(repo, "environments", "dev"),
+		"base_path through symlink": link,
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := &Config{
+				BasePath: basePath,
+				Modules:  []Module{{Path: "network"}, {Path: "db"}},
+			}
+			if diff := cmp.Diff(want, cfg.ModulesForFiles(files)); diff != "" {
+				t.Errorf("ModulesForFiles() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestChangedModules(t *testing.T) {
+	old := &Config{
+		BasePath: "environments/dev",
+		Modules: []Module{
+			{Path: "network"},
+			{Path: "db", DependsOn: []string{"network"}},
+			{Path: "api", DependsOn: []string{"db", "network"}, Tags: []string{"app"}},
+			{Path: "legacy"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		old  *Config
+		new  *Config
+		want []string
+	}{
+		{
+			name: "new module and new dependency edge",
+			old:  old,
+			new: &Config{
+				BasePath: "environments/dev",
+				Modules: []Module{
+					{Path: "network"},
+					{Path: "iam"},
+					{Path: "db", DependsOn: []string{"network", "iam"}},
+					{Path: "api", DependsOn: []string{"network", "db"}, Tags: []string{"app", "tier-1"}},
+				},
+			},
+			want: []string{"iam", "db"},
+		},
+		{
+			name: "no previous config",
+			old:  nil,
+			new:  old,
+			want: []string{"network", "db", "api", "legacy"},
+		},
+		{
+			name: "base path changed",
+			old:  old,
+			new: &Config{
+				BasePath: "environments/stg",
+				Modules:  []Module{{Path: "network"}},
+			},
+			want: []string{"network"},
+		},
+		{
+			name: "top-level binary changed",
+			old: &Config{
+				BasePath: "environments/dev",
+				Modules: []Module{
+					{Path: "network"},
+					{Path: "db", DependsOn: []string{"network"}, Binary: "terraform"},
+				},
+			},
+			new: &Config{
+				BasePath: "environments/dev",
+				Binary:   "tofu",
+				Modules: []Module{
+					{Path: "network"},
+					{Path: "db", DependsOn: []string{"network"}, Binary: "terraform"},
+				},
+			},
+			want: []string{"network"},
+		},
+		{
+			name: "top-level required_version changed",
+			old: &Config{
+				BasePath:        "environments/dev",
+				RequiredVersion: "~> 1.5",
+				Modules: []Module{
+					{Path: "network"},
+					{Path: "db", DependsOn: []string{"network"}, RequiredVersion: "~> 1.5"},
+				},
+			},
+			new: &Config{
+				BasePath:        "environments/dev",
+				RequiredVersion: "~> 1.9",
+				Modules: []Module{
+					{Path: "network"},
+					{Path: "db", DependsOn: []string{"network"}, RequiredVersion: "~> 1.5"},
+				},
+			},
+			want: []string{"network"},
+		},
+		{
+			name: "top-level retry changed",
+			old:  old,
+			new: &Config{
+				BasePath: "environments/dev",
+				Retry:    &Retry{Patterns: []string{"state lock"}},
+				Modules: []Module{
+					{Path: "network"},
+					{Path: "db", DependsOn: []string{"network"}},
+				},
+			},
+			want: []string{"network", "db"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.new.ChangedModules(tt.old)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ChangedModules() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -9,11 +10,50 @@ import (
 type Config struct {
 	BasePath string   `yaml:"base_path"`
 	Modules  []Module `yaml:"modules"`
+	// Retry is the default retry policy of every module.
+	Retry *Retry `yaml:"retry,omitempty"`
+	// Binary is the command modules run instead of terraform, such as tofu
+	// or a wrapper script.
+	Binary string `yaml:"binary,omitempty"`
+	// Docker runs every step in a container when set.
+	Docker *Docker `yaml:"docker,omitempty"`
+	// RequiredVersion constrains the binary version of every module, such
+	// as ">= 1.5, < 1.10".
+	RequiredVersion string `yaml:"required_version,omitempty"`
+	// VersionsDir holds installed binaries as <version>/<binary>, such as
+	// ~/.tfenv/versions, to pick from when a module's binary does not
+	// satisfy its version constraint.
+	VersionsDir string `yaml:"versions_dir,omitempty"`
 }
 
 type Module struct {
 	Path      string   `yaml:"path"`
 	DependsOn []string `yaml:"depends_on,omitempty"`
+	Tags      []string `yaml:"tags,omitempty"`
+	// Timeout limits how long the module's terraform steps may run in
+	// total, e.g. "30m". Zero means no limit.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Retry overrides the fields it sets in the config's retry policy.
+	Retry *Retry `yaml:"retry,omitempty"`
+	// Binary overrides the config's binary for this module.
+	Binary string `yaml:"binary,omitempty"`
+	// RequiredVersion overrides the config's version constraint and any
+	// version file for this module.
+	RequiredVersion string `yaml:"required_version,omitempty"`
+}
+
+// DefaultBinary is the command modules run when no binary is configured.
+const DefaultBinary = "terraform"
+
+// binaryFor returns the command mod runs.
+func (c *Config) binaryFor(mod Module) string {
+	switch {
+	case mod.Binary != "":
+		return mod.Binary
+	case c.Binary != "":
+		return c.Binary
+	}
+	return DefaultBinary
 }
 
 func LoadConfig(path string) (*Config, error) {
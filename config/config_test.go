@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -41,6 +42,76 @@ func TestLoadConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:      "config with tags",
+			filename:  "tags.yaml",
+			wantError: false,
+			want: &Config{
+				BasePath: "test/path",
+				Modules: []Module{
+					{Path: "module-a", Tags: []string{"networking", "tier-1"}},
+					{Path: "module-b", DependsOn: []string{"module-a"}, Tags: []string{"data"}},
+				},
+			},
+		},
+		{
+			name:      "config with timeouts",
+			filename:  "timeouts.yaml",
+			wantError: false,
+			want: &Config{
+				BasePath: "test/path",
+				Modules: []Module{
+					{Path: "module-a", Timeout: 30 * time.Minute},
+					{Path: "module-b", DependsOn: []string{"module-a"}, Timeout: 90 * time.Minute},
+					{Path: "module-c"},
+				},
+			},
+		},
+		{
+			name:      "config with retry policies",
+			filename:  "retry.yaml",
+			wantError: false,
+			want: &Config{
+				BasePath: "test/path",
+				Modules: []Module{
+					{Path: "module-a"},
+					{Path: "module-b", Retry: &Retry{MaxAttempts: 1}},
+				},
+				Retry: &Retry{
+					MaxAttempts: 4,
+					Backoff:     5 * time.Second,
+					Patterns:    []string{"Error acquiring the state lock"},
+				},
+			},
+		},
+		{
+			name:      "config with binaries",
+			filename:  "binary.yaml",
+			wantError: false,
+			want: &Config{
+				BasePath: "test/path",
+				Binary:   "terraform-1.9",
+				Modules: []Module{
+					{Path: "module-a"},
+					{Path: "module-b", DependsOn: []string{"module-a"}, Binary: "tofu"},
+				},
+			},
+		},
+		{
+			name:      "config with docker",
+			filename:  "docker.yaml",
+			wantError: false,
+			want: &Config{
+				BasePath: "test/path",
+				Modules:  []Module{{Path: "module-a"}},
+				Docker: &Docker{
+					Image:       "hashicorp/terraform:1.9.5",
+					PluginCache: "/var/cache/terraform-plugins",
+					Env:         []string{"AWS_REGION", "AWS_PROFILE"},
+					Files:       []string{"~/.aws"},
+				},
+			},
+		},
 		{
 			name:      "invalid yaml",
 			filename:  "invalid.yaml",
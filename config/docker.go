@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Docker configures running every terraform step in a container instead of
+// with a local binary. The working directory is mounted into the container
+// at the same path, so relative module sources keep working, and the
+// module's binary is run as the container's entrypoint.
+type Docker struct {
+	// Image is the container image, such as hashicorp/terraform:1.9.5.
+	Image string `yaml:"image"`
+	// PluginCache is a host directory shared by all containers as the
+	// provider plugin cache. It defaults to ~/.terraform.d/plugin-cache.
+	PluginCache string `yaml:"plugin_cache,omitempty"`
+	// Env lists environment variables passed through to the container, such
+	// as AWS_REGION. Unset variables are not passed.
+	Env []string `yaml:"env,omitempty"`
+	// Files lists credential files and directories, such as ~/.aws, that
+	// are mounted read-only at the same path.
+	Files []string `yaml:"files,omitempty"`
+}
+
+// validate returns a message for each invalid setting of d.
+func (d *Docker) validate() []string {
+	if d == nil {
+		return nil
+	}
+	var msgs []string
+	if d.Image == "" {
+		msgs = append(msgs, "image is required")
+	}
+	for _, name := range d.Env {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			msgs = append(msgs, fmt.Sprintf("invalid env variable name %q", name))
+		}
+	}
+	for _, file := range d.Files {
+		if file == "" {
+			msgs = append(msgs, "empty path in files")
+		}
+	}
+	return msgs
+}
@@ -2,19 +2,33 @@ package config
 
 import (
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 )
 
 // ModuleNode represents a node in the execution graph.
 type ModuleNode struct {
 	Path      string
 	DependsOn []string
-	Visited   bool
-	TempMark  bool
+	Tags      []string
+	Timeout   time.Duration
+	// Retry is the module's retry policy, with the config defaults applied.
+	Retry Retry
+	// Binary is the command the module runs, such as terraform or tofu.
+	Binary string
+	// RequiredVersion is the version constraint the binary must satisfy,
+	// from the module, a version file or the config. Empty means any.
+	RequiredVersion string
 }
 
 // ExecutionGraph holds all module nodes for dependency resolution.
 type ExecutionGraph struct {
 	Nodes map[string]*ModuleNode
+	// Order lists module paths in the order they appear in the config and is
+	// used to break ties so that execution order is stable between runs.
+	Order []string
 }
 
 // BuildExecutionGraph builds a graph from the given Config.
@@ -23,50 +37,370 @@ func BuildExecutionGraph(cfg *Config) (*ExecutionGraph, error) {
 
 	// Initialize nodes
 	for _, mod := range cfg.Modules {
+		if _, exists := graph.Nodes[mod.Path]; !exists {
+			graph.Order = append(graph.Order, mod.Path)
+		}
+		required, err := cfg.requiredVersionFor(mod)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read version file of module %s: %w", mod.Path, err)
+		}
 		graph.Nodes[mod.Path] = &ModuleNode{
-			Path:      mod.Path,
-			DependsOn: mod.DependsOn,
+			Path:            mod.Path,
+			DependsOn:       mod.DependsOn,
+			Tags:            mod.Tags,
+			Timeout:         mod.Timeout,
+			Retry:           cfg.retryFor(mod),
+			Binary:          cfg.binaryFor(mod),
+			RequiredVersion: required,
 		}
 	}
 
 	return graph, nil
 }
 
+// orderedNodes returns all nodes in config order. Graphs built without Order
+// fall back to sorting by path.
+func (g *ExecutionGraph) orderedNodes() []*ModuleNode {
+	order := g.Order
+	if len(order) != len(g.Nodes) {
+		order = make([]string, 0, len(g.Nodes))
+		for path := range g.Nodes {
+			order = append(order, path)
+		}
+		sort.Strings(order)
+	}
+
+	nodes := make([]*ModuleNode, 0, len(order))
+	for _, path := range order {
+		nodes = append(nodes, g.Nodes[path])
+	}
+	return nodes
+}
+
 // TopoSortedModules performs topological sort to determine execution order.
+// Whenever several modules are ready to run, the one declared first in the
+// config comes first, so the result is the same on every run.
 func (g *ExecutionGraph) TopoSortedModules() ([]*ModuleNode, error) {
-	var sorted []*ModuleNode
-	visited := make(map[string]bool)
-
-	var visit func(n *ModuleNode) error
-	visit = func(n *ModuleNode) error {
-		if n.TempMark {
-			return fmt.Errorf("cyclic dependency detected at %s", n.Path)
-		}
-		if !visited[n.Path] {
-			n.TempMark = true
-			for _, dep := range n.DependsOn {
-				depNode, exists := g.Nodes[dep]
-				if !exists {
-					return fmt.Errorf("unknown dependency %s for module %s", dep, n.Path)
+	nodes := g.orderedNodes()
+	pending, dependents, err := g.indegrees(nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	var ready []int
+	for i, node := range nodes {
+		if pending[node.Path] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	index := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		index[node.Path] = i
+	}
+
+	sorted := make([]*ModuleNode, 0, len(nodes))
+	for len(ready) > 0 {
+		sort.Ints(ready)
+		node := nodes[ready[0]]
+		ready = ready[1:]
+		sorted = append(sorted, node)
+
+		for _, dependent := range dependents[node.Path] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, index[dependent])
+			}
+		}
+	}
+
+	if len(sorted) != len(nodes) {
+		return nil, g.cycleError(nodes, pending)
+	}
+	return sorted, nil
+}
+
+// Levels groups modules into waves. Every module in a wave depends only on
+// modules from earlier waves, so the modules of one wave can run together.
+// Modules within a wave keep their config order.
+func (g *ExecutionGraph) Levels() ([][]*ModuleNode, error) {
+	sorted, err := g.TopoSortedModules()
+	if err != nil {
+		return nil, err
+	}
+
+	level := make(map[string]int, len(sorted))
+	var levels [][]*ModuleNode
+	for _, node := range sorted {
+		l := 0
+		for _, dep := range node.DependsOn {
+			if level[dep]+1 > l {
+				l = level[dep] + 1
+			}
+		}
+		level[node.Path] = l
+		if l == len(levels) {
+			levels = append(levels, nil)
+		}
+		levels[l] = append(levels[l], node)
+	}
+
+	// Sorting by wave can reorder modules relative to the config, so
+	// restore config order inside each wave.
+	index := make(map[string]int, len(g.Order))
+	for i, node := range g.orderedNodes() {
+		index[node.Path] = i
+	}
+	for _, wave := range levels {
+		sort.SliceStable(wave, func(i, j int) bool {
+			return index[wave[i].Path] < index[wave[j].Path]
+		})
+	}
+
+	return levels, nil
+}
+
+// indegrees counts the distinct dependencies of every node and records the
+// reverse edges. It fails on the first dependency that is not in the graph.
+func (g *ExecutionGraph) indegrees(nodes []*ModuleNode) (map[string]int, map[string][]string, error) {
+	pending := make(map[string]int, len(nodes))
+	dependents := make(map[string][]string)
+	for _, node := range nodes {
+		seen := make(map[string]bool, len(node.DependsOn))
+		for _, dep := range node.DependsOn {
+			if _, exists := g.Nodes[dep]; !exists {
+				return nil, nil, fmt.Errorf("unknown dependency %s for module %s", dep, node.Path)
+			}
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			pending[node.Path]++
+			dependents[dep] = append(dependents[dep], node.Path)
+		}
+	}
+	return pending, dependents, nil
+}
+
+// cycleError describes the first cycle that prevents the graph from being
+// sorted, or the first blocked module if no cycle can be traced.
+func (g *ExecutionGraph) cycleError(nodes []*ModuleNode, pending map[string]int) error {
+	if cycles := g.Cycles(); len(cycles) > 0 {
+		return fmt.Errorf("cyclic dependency detected: %s", strings.Join(cycles[0], " -> "))
+	}
+	for _, node := range nodes {
+		if pending[node.Path] > 0 {
+			return fmt.Errorf("cyclic dependency detected at %s", node.Path)
+		}
+	}
+	return fmt.Errorf("cyclic dependency detected")
+}
+
+// Cycles returns every elementary dependency cycle in the graph. Each cycle
+// starts and ends with the module declared first in the config, e.g.
+// [a b c a] for a -> b -> c -> a. A module depending on itself is reported
+// as [a a]. Unknown dependencies are ignored.
+//
+// Cycles are listed with Johnson's algorithm, searching only inside the
+// strongly connected components that hold a cycle, so an acyclic graph
+// costs time linear in its size.
+func (g *ExecutionGraph) Cycles() [][]string {
+	nodes := g.orderedNodes()
+	index := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		index[node.Path] = i
+	}
+
+	// deps lists the distinct known dependencies of every node by index.
+	deps := make([][]int, len(nodes))
+	for i, node := range nodes {
+		seen := make(map[int]bool, len(node.DependsOn))
+		for _, dep := range node.DependsOn {
+			j, exists := index[dep]
+			if !exists || seen[j] {
+				continue
+			}
+			seen[j] = true
+			deps[i] = append(deps[i], j)
+		}
+	}
+
+	component := stronglyConnected(deps)
+	size := make(map[int]int)
+	for _, c := range component {
+		size[c]++
+	}
+
+	var cycles [][]string
+	blocked := make([]bool, len(nodes))
+	blockedBy := make([]map[int]bool, len(nodes))
+	var path []int
+
+	var unblock func(v int)
+	unblock = func(v int) {
+		blocked[v] = false
+		for w := range blockedBy[v] {
+			delete(blockedBy[v], w)
+			if blocked[w] {
+				unblock(w)
+			}
+		}
+	}
+
+	for start := range nodes {
+		if size[component[start]] == 1 && !slices.Contains(deps[start], start) {
+			continue
+		}
+		// A cycle through start stays inside its component and, being
+		// reported from its first module, uses no module declared earlier.
+		inSearch := func(v int) bool {
+			return v >= start && component[v] == component[start]
+		}
+		for v := range nodes {
+			if inSearch(v) {
+				blocked[v] = false
+				blockedBy[v] = make(map[int]bool)
+			}
+		}
+
+		var circuit func(v int) bool
+		circuit = func(v int) bool {
+			found := false
+			path = append(path, v)
+			blocked[v] = true
+			for _, w := range deps[v] {
+				switch {
+				case w == start:
+					cycle := make([]string, 0, len(path)+1)
+					for _, i := range path {
+						cycle = append(cycle, nodes[i].Path)
+					}
+					cycles = append(cycles, append(cycle, nodes[start].Path))
+					found = true
+				case inSearch(w) && !blocked[w]:
+					if circuit(w) {
+						found = true
+					}
 				}
-				if err := visit(depNode); err != nil {
-					return err
+			}
+			if found {
+				unblock(v)
+			} else {
+				for _, w := range deps[v] {
+					if inSearch(w) {
+						blockedBy[w][v] = true
+					}
 				}
 			}
-			n.TempMark = false
-			visited[n.Path] = true
-			sorted = append(sorted, n)
+			path = path[:len(path)-1]
+			return found
 		}
-		return nil
+		circuit(start)
 	}
+	return cycles
+}
 
-	for _, node := range g.Nodes {
-		if !visited[node.Path] {
-			if err := visit(node); err != nil {
-				return nil, err
+// stronglyConnected labels every node of the graph given by deps with its
+// strongly connected component, using Tarjan's algorithm.
+func stronglyConnected(deps [][]int) []int {
+	component := make([]int, len(deps))
+	order := make([]int, len(deps))
+	low := make([]int, len(deps))
+	onStack := make([]bool, len(deps))
+	var stack []int
+	next, components := 1, 0
+
+	var connect func(v int)
+	connect = func(v int) {
+		order[v], low[v] = next, next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range deps[v] {
+			switch {
+			case order[w] == 0:
+				connect(w)
+				low[v] = min(low[v], low[w])
+			case onStack[w]:
+				low[v] = min(low[v], order[w])
 			}
 		}
+		if low[v] != order[v] {
+			return
+		}
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component[w] = components
+			if w == v {
+				break
+			}
+		}
+		components++
 	}
 
-	return sorted, nil
+	for v := range deps {
+		if order[v] == 0 {
+			connect(v)
+		}
+	}
+	return component
+}
+
+// Dependencies returns every module that the given modules depend on,
+// directly or transitively, in config order. The given modules are not
+// included in the result.
+func (g *ExecutionGraph) Dependencies(paths ...string) []string {
+	return g.closure(paths, func(n *ModuleNode) []string {
+		return n.DependsOn
+	})
+}
+
+// Dependents returns every module that depends on the given modules,
+// directly or transitively, in config order. The given modules are not
+// included in the result.
+func (g *ExecutionGraph) Dependents(paths ...string) []string {
+	dependents := make(map[string][]string)
+	for _, node := range g.orderedNodes() {
+		for _, dep := range node.DependsOn {
+			dependents[dep] = append(dependents[dep], node.Path)
+		}
+	}
+	return g.closure(paths, func(n *ModuleNode) []string {
+		return dependents[n.Path]
+	})
+}
+
+// closure walks the graph from paths along next and returns the reached
+// modules in config order.
+func (g *ExecutionGraph) closure(paths []string, next func(*ModuleNode) []string) []string {
+	start := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		start[path] = true
+	}
+
+	reached := make(map[string]bool)
+	queue := append([]string(nil), paths...)
+	for len(queue) > 0 {
+		node, exists := g.Nodes[queue[0]]
+		queue = queue[1:]
+		if !exists {
+			continue
+		}
+		for _, path := range next(node) {
+			if !reached[path] {
+				reached[path] = true
+				queue = append(queue, path)
+			}
+		}
+	}
+
+	var result []string
+	for _, node := range g.orderedNodes() {
+		if reached[node.Path] && !start[node.Path] {
+			result = append(result, node.Path)
+		}
+	}
+	return result
 }
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestBuildExecutionGraph(t *testing.T) {
@@ -41,6 +44,21 @@ func TestBuildExecutionGraph(t *testing.T) {
 					if len(node.DependsOn) != 0 {
 						t.Errorf("expected node %s to have no dependencies, got %d", path, len(node.DependsOn))
 					}
+					if node.Binary != DefaultBinary {
+						t.Errorf("expected node %s to run %s, got %s", path, DefaultBinary, node.Binary)
+					}
+				}
+			},
+		},
+		{
+			name:     "binaries",
+			filename: "binary.yaml",
+			validate: func(t *testing.T, g *ExecutionGraph) {
+				if got := g.Nodes["module-a"].Binary; got != "terraform-1.9" {
+					t.Errorf("expected module-a to run the config's binary, got %s", got)
+				}
+				if got := g.Nodes["module-b"].Binary; got != "tofu" {
+					t.Errorf("expected module-b to run its own binary, got %s", got)
 				}
 			},
 		},
@@ -180,6 +198,84 @@ func TestCyclicDependencyDetection(t *testing.T) {
 	}
 }
 
+func TestCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules []Module
+		want    [][]string
+	}{
+		{
+			name: "acyclic",
+			modules: []Module{
+				{Path: "app", DependsOn: []string{"network", "db"}},
+				{Path: "db", DependsOn: []string{"network"}},
+				{Path: "network"},
+			},
+		},
+		{
+			name: "self dependency",
+			modules: []Module{
+				{Path: "a", DependsOn: []string{"a"}},
+			},
+			want: [][]string{{"a", "a"}},
+		},
+		{
+			name: "cycles sharing modules",
+			modules: []Module{
+				{Path: "a", DependsOn: []string{"b", "c"}},
+				{Path: "b", DependsOn: []string{"a", "c"}},
+				{Path: "c", DependsOn: []string{"a"}},
+				{Path: "d", DependsOn: []string{"a"}},
+			},
+			want: [][]string{{"a", "b", "a"}, {"a", "b", "c", "a"}, {"a", "c", "a"}},
+		},
+		{
+			name: "separate cycles",
+			modules: []Module{
+				{Path: "a", DependsOn: []string{"b"}},
+				{Path: "b", DependsOn: []string{"a", "missing"}},
+				{Path: "c", DependsOn: []string{"a", "e"}},
+				{Path: "d", DependsOn: []string{"c"}},
+				{Path: "e", DependsOn: []string{"d"}},
+			},
+			want: [][]string{{"a", "b", "a"}, {"c", "e", "d", "c"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph, err := BuildExecutionGraph(&Config{Modules: tt.modules})
+			if err != nil {
+				t.Fatalf("failed to build graph: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, graph.Cycles()); diff != "" {
+				t.Errorf("Cycles() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCyclesDenseDAG(t *testing.T) {
+	// Every module depends on all modules declared after it, so a search
+	// that follows every path would take exponential time.
+	var modules []Module
+	for i := range 60 {
+		mod := Module{Path: fmt.Sprintf("m%02d", i)}
+		for j := i + 1; j < 60; j++ {
+			mod.DependsOn = append(mod.DependsOn, fmt.Sprintf("m%02d", j))
+		}
+		modules = append(modules, mod)
+	}
+
+	graph, err := BuildExecutionGraph(&Config{Modules: modules})
+	if err != nil {
+		t.Fatalf("failed to build graph: %v", err)
+	}
+	if cycles := graph.Cycles(); len(cycles) != 0 {
+		t.Errorf("expected no cycles, got %v", cycles)
+	}
+}
+
 func TestUnknownDependency(t *testing.T) {
 	path := filepath.Join("..", "testdata", "unknown-dep.yaml")
 	cfg, err := LoadConfig(path)
@@ -251,3 +347,176 @@ func TestComplexDependencyGraph(t *testing.T) {
 		t.Error("module d should come before e")
 	}
 }
+
+func TestTopoSortedModulesIsDeterministic(t *testing.T) {
+	cfg := &Config{
+		BasePath: "test",
+		Modules: []Module{
+			{Path: "network"},
+			{Path: "serviceA", DependsOn: []string{"network"}},
+			{Path: "serviceB", DependsOn: []string{"network"}},
+			{Path: "dns"},
+			{Path: "monitoring", DependsOn: []string{"serviceA", "serviceB"}},
+			{Path: "iam"},
+		},
+	}
+	want := []string{"network", "serviceA", "serviceB", "dns", "monitoring", "iam"}
+
+	for i := 0; i < 20; i++ {
+		graph, err := BuildExecutionGraph(cfg)
+		if err != nil {
+			t.Fatalf("failed to build graph: %v", err)
+		}
+		sorted, err := graph.TopoSortedModules()
+		if err != nil {
+			t.Fatalf("failed to sort: %v", err)
+		}
+
+		var got []string
+		for _, node := range sorted {
+			got = append(got, node.Path)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("TopoSortedModules() mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestTopoSortedModulesDependencyDeclaredLater(t *testing.T) {
+	cfg := &Config{
+		Modules: []Module{
+			{Path: "app", DependsOn: []string{"network"}},
+			{Path: "dns"},
+			{Path: "network"},
+		},
+	}
+
+	graph, err := BuildExecutionGraph(cfg)
+	if err != nil {
+		t.Fatalf("failed to build graph: %v", err)
+	}
+	sorted, err := graph.TopoSortedModules()
+	if err != nil {
+		t.Fatalf("failed to sort: %v", err)
+	}
+
+	var got []string
+	for _, node := range sorted {
+		got = append(got, node.Path)
+	}
+	want := []string{"dns", "network", "app"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("TopoSortedModules() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	tests := []struct {
+		name      string
+		modules   []Module
+		want      [][]string
+		wantError bool
+	}{
+		{
+			name: "fan out and fan in",
+			modules: []Module{
+				{Path: "network"},
+				{Path: "serviceA", DependsOn: []string{"network"}},
+				{Path: "serviceB", DependsOn: []string{"network"}},
+				{Path: "monitoring", DependsOn: []string{"serviceA", "serviceB"}},
+				{Path: "iam"},
+			},
+			want: [][]string{
+				{"network", "iam"},
+				{"serviceA", "serviceB"},
+				{"monitoring"},
+			},
+		},
+		{
+			name: "longest path decides the wave",
+			modules: []Module{
+				{Path: "d", DependsOn: []string{"a", "c"}},
+				{Path: "c", DependsOn: []string{"b"}},
+				{Path: "b", DependsOn: []string{"a"}},
+				{Path: "a"},
+			},
+			want: [][]string{{"a"}, {"b"}, {"c"}, {"d"}},
+		},
+		{
+			name: "cycle",
+			modules: []Module{
+				{Path: "a", DependsOn: []string{"b"}},
+				{Path: "b", DependsOn: []string{"a"}},
+			},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph, err := BuildExecutionGraph(&Config{Modules: tt.modules})
+			if err != nil {
+				t.Fatalf("failed to build graph: %v", err)
+			}
+
+			levels, err := graph.Levels()
+			if tt.wantError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got [][]string
+			for _, wave := range levels {
+				var paths []string
+				for _, node := range wave {
+					paths = append(paths, node.Path)
+				}
+				got = append(got, paths)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Levels() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDependenciesAndDependents(t *testing.T) {
+	graph, err := BuildExecutionGraph(&Config{
+		Modules: []Module{
+			{Path: "network"},
+			{Path: "iam"},
+			{Path: "db", DependsOn: []string{"network"}},
+			{Path: "app", DependsOn: []string{"db", "iam"}},
+			{Path: "monitoring", DependsOn: []string{"app"}},
+			{Path: "dns"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to build graph: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{name: "dependencies of app", got: graph.Dependencies("app"), want: []string{"network", "iam", "db"}},
+		{name: "dependencies of a root", got: graph.Dependencies("network"), want: nil},
+		{name: "dependents of network", got: graph.Dependents("network"), want: []string{"db", "app", "monitoring"}},
+		{name: "dependents of several modules", got: graph.Dependents("iam", "dns"), want: []string{"app", "monitoring"}},
+		{name: "dependents of unknown module", got: graph.Dependents("missing"), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, tt.got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
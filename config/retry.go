@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Retry defaults used when a retry policy leaves them unset.
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBackoff     = 10 * time.Second
+	DefaultRetryMaxBackoff  = 5 * time.Minute
+)
+
+// Retry configures when a failed terraform step is run again. A step is
+// retried only if its output matches one of Patterns, and at most
+// MaxAttempts times in total. The wait before each retry starts at Backoff
+// and doubles every time, up to MaxBackoff.
+type Retry struct {
+	MaxAttempts int           `yaml:"max_attempts,omitempty"`
+	Backoff     time.Duration `yaml:"backoff,omitempty"`
+	MaxBackoff  time.Duration `yaml:"max_backoff,omitempty"`
+	Patterns    []string      `yaml:"patterns,omitempty"`
+}
+
+// retryFor returns the retry policy of mod: the config's policy with the
+// fields set on the module overriding it, and the defaults for fields set
+// on neither.
+func (c *Config) retryFor(mod Module) Retry {
+	r := Retry{
+		MaxAttempts: DefaultRetryMaxAttempts,
+		Backoff:     DefaultRetryBackoff,
+		MaxBackoff:  DefaultRetryMaxBackoff,
+	}
+	for _, override := range []*Retry{c.Retry, mod.Retry} {
+		if override == nil {
+			continue
+		}
+		if override.MaxAttempts != 0 {
+			r.MaxAttempts = override.MaxAttempts
+		}
+		if override.Backoff != 0 {
+			r.Backoff = override.Backoff
+		}
+		if override.MaxBackoff != 0 {
+			r.MaxBackoff = override.MaxBackoff
+		}
+		if override.Patterns != nil {
+			r.Patterns = override.Patterns
+		}
+	}
+	return r
+}
+
+// Enabled reports whether failed steps may be retried at all.
+func (r Retry) Enabled() bool {
+	return r.MaxAttempts > 1 && len(r.Patterns) > 0
+}
+
+// Matcher compiles Patterns into a single expression that matches output
+// matched by any of them.
+func (r Retry) Matcher() (*regexp.Regexp, error) {
+	parts := make([]string, len(r.Patterns))
+	for i, pattern := range r.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid retry pattern %q: %v", pattern, err)
+		}
+		parts[i] = "(?:" + pattern + ")"
+	}
+	return regexp.Compile(strings.Join(parts, "|"))
+}
+
+// Delay returns the wait before the retry that follows failed attempt
+// number attempt, counting from 1.
+func (r Retry) Delay(attempt int) time.Duration {
+	delay := r.Backoff
+	for i := 1; i < attempt && delay < r.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.MaxBackoff)
+}
+
+// validate returns a message for each invalid setting of r.
+func (r *Retry) validate() []string {
+	if r == nil {
+		return nil
+	}
+	var msgs []string
+	if r.MaxAttempts < 0 {
+		msgs = append(msgs, fmt.Sprintf("negative max_attempts %d", r.MaxAttempts))
+	}
+	if r.Backoff < 0 {
+		msgs = append(msgs, fmt.Sprintf("negative backoff %s", r.Backoff))
+	}
+	if r.MaxBackoff < 0 {
+		msgs = append(msgs, fmt.Sprintf("negative max_backoff %s", r.MaxBackoff))
+	}
+	for _, pattern := range r.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			msgs = append(msgs, fmt.Sprintf("invalid pattern %q: %v", pattern, err))
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRetryFor(t *testing.T) {
+	cfg := &Config{
+		Retry: &Retry{
+			MaxAttempts: 4,
+			Backoff:     time.Second,
+			Patterns:    []string{"Error acquiring the state lock"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		cfg  *Config
+		mod  Module
+		want Retry
+	}{
+		{
+			name: "defaults",
+			cfg:  &Config{},
+			mod:  Module{Path: "a"},
+			want: Retry{MaxAttempts: DefaultRetryMaxAttempts, Backoff: DefaultRetryBackoff, MaxBackoff: DefaultRetryMaxBackoff},
+		},
+		{
+			name: "config policy",
+			cfg:  cfg,
+			mod:  Module{Path: "a"},
+			want: Retry{MaxAttempts: 4, Backoff: time.Second, MaxBackoff: DefaultRetryMaxBackoff, Patterns: []string{"Error acquiring the state lock"}},
+		},
+		{
+			name: "module overrides",
+			cfg:  cfg,
+			mod:  Module{Path: "a", Retry: &Retry{MaxAttempts: 6, Patterns: []string{"Throttling"}}},
+			want: Retry{MaxAttempts: 6, Backoff: time.Second, MaxBackoff: DefaultRetryMaxBackoff, Patterns: []string{"Throttling"}},
+		},
+		{
+			name: "module disables retries",
+			cfg:  cfg,
+			mod:  Module{Path: "a", Retry: &Retry{MaxAttempts: 1}},
+			want: Retry{MaxAttempts: 1, Backoff: time.Second, MaxBackoff: DefaultRetryMaxBackoff, Patterns: []string{"Error acquiring the state lock"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, tt.cfg.retryFor(tt.mod)); diff != "" {
+				t.Errorf("retry mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRetryEnabled(t *testing.T) {
+	if (Retry{MaxAttempts: 3}).Enabled() {
+		t.Error("expected a policy without patterns to be disabled")
+	}
+	if (Retry{MaxAttempts: 1, Patterns: []string{"x"}}).Enabled() {
+		t.Error("expected a policy with a single attempt to be disabled")
+	}
+	if !(Retry{MaxAttempts: 2, Patterns: []string{"x"}}).Enabled() {
+		t.Error("expected a policy with patterns and attempts left to be enabled")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	r := Retry{Backoff: 10 * time.Second, MaxBackoff: time.Minute}
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, w := range want {
+		if got := r.Delay(i + 1); got != w {
+			t.Errorf("Delay(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
+
+func TestRetryMatcher(t *testing.T) {
+	r := Retry{Patterns: []string{"state lock", `Throttling(Exception)?`}}
+	re, err := r.Matcher()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for text, want := range map[string]bool{
+		"Error acquiring the state lock":   true,
+		"api error ThrottlingException":    true,
+		"Error: creating EC2 Instance: no": false,
+	} {
+		if got := re.MatchString(text); got != want {
+			t.Errorf("match %q = %v, want %v", text, got, want)
+		}
+	}
+
+	if _, err := (Retry{Patterns: []string{"("}}).Matcher(); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
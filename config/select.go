@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Selector chooses a subset of the modules in an ExecutionGraph.
+type Selector struct {
+	// Targets are glob patterns of modules to include. When empty, every
+	// module is included.
+	Targets []string
+	// Excludes are glob patterns of modules to leave out. Excludes win over
+	// every other rule, including dependency expansion.
+	Excludes []string
+	// Tags, when set, keeps only modules whose tags match the expression.
+	Tags TagExpr
+	// SkipTags leaves out modules whose tags match the expression. Like
+	// Excludes, it wins over dependency expansion.
+	SkipTags TagExpr
+	// Only, when non-nil, keeps only the modules in the set. It is applied
+	// before dependency expansion, like Targets.
+	Only map[string]bool
+	// WithDependencies adds every module the selected modules depend on.
+	WithDependencies bool
+	// WithDependents adds every module that depends on the selected modules.
+	WithDependents bool
+}
+
+// MatchModule reports whether the module path matches pattern. Patterns use
+// path.Match syntax and are matched against the whole path and against each
+// of its parent directories, so "shared" and "shared/*" both match
+// "shared/network/vpc".
+func MatchModule(pattern, modulePath string) (bool, error) {
+	pattern = strings.TrimSuffix(pattern, "/")
+	candidate := modulePath
+	for {
+		matched, err := path.Match(pattern, candidate)
+		if err != nil {
+			return false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if matched {
+			return true, nil
+		}
+		i := strings.LastIndex(candidate, "/")
+		if i < 0 {
+			return false, nil
+		}
+		candidate = candidate[:i]
+	}
+}
+
+// Select returns the set of module paths chosen by s. A target that matches
+// no module is an error, since it is most likely a typo.
+func (g *ExecutionGraph) Select(s Selector) (map[string]bool, error) {
+	nodes := g.orderedNodes()
+
+	excluded := make(map[string]bool)
+	if s.SkipTags != nil {
+		for _, node := range nodes {
+			if s.SkipTags.Match(node.Tags) {
+				excluded[node.Path] = true
+			}
+		}
+	}
+	for _, pattern := range s.Excludes {
+		for _, node := range nodes {
+			matched, err := MatchModule(pattern, node.Path)
+			if err != nil {
+				return nil, err
+			}
+			if matched {
+				excluded[node.Path] = true
+			}
+		}
+	}
+
+	selected := make(map[string]bool)
+	if len(s.Targets) == 0 {
+		for _, node := range nodes {
+			selected[node.Path] = true
+		}
+	}
+	for _, pattern := range s.Targets {
+		found := false
+		for _, node := range nodes {
+			matched, err := MatchModule(pattern, node.Path)
+			if err != nil {
+				return nil, err
+			}
+			if matched {
+				selected[node.Path] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("target %s does not match any module", pattern)
+		}
+	}
+
+	for _, node := range nodes {
+		if excluded[node.Path] || (s.Tags != nil && !s.Tags.Match(node.Tags)) || (s.Only != nil && !s.Only[node.Path]) {
+			delete(selected, node.Path)
+		}
+	}
+
+	var base []string
+	for _, node := range nodes {
+		if selected[node.Path] {
+			base = append(base, node.Path)
+		}
+	}
+	if s.WithDependencies {
+		for _, path := range g.Dependencies(base...) {
+			selected[path] = true
+		}
+	}
+	if s.WithDependents {
+		for _, path := range g.Dependents(base...) {
+			selected[path] = true
+		}
+	}
+
+	for path := range excluded {
+		delete(selected, path)
+	}
+	return selected, nil
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatchModule(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "shared/network", path: "shared/network", want: true},
+		{pattern: "shared/*", path: "shared/network", want: true},
+		{pattern: "shared", path: "shared/network", want: true},
+		{pattern: "shared/", path: "shared/network/vpc", want: true},
+		{pattern: "service*", path: "serviceA/backend", want: true},
+		{pattern: "*/backend", path: "serviceA/backend", want: true},
+		{pattern: "*/backend", path: "serviceA/frontend", want: false},
+		{pattern: "shared/net", path: "shared/network", want: false},
+		{pattern: "network", path: "shared/network", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			got, err := MatchModule(tt.pattern, tt.path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("MatchModule(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := MatchModule("[", "a"); err == nil {
+		t.Error("expected error for invalid pattern but got none")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	graph, err := BuildExecutionGraph(&Config{
+		Modules: []Module{
+			{Path: "shared/network"},
+			{Path: "shared/iam"},
+			{Path: "serviceA/backend", DependsOn: []string{"shared/network", "shared/iam"}},
+			{Path: "serviceB/backend", DependsOn: []string{"shared/network"}},
+			{Path: "shared/monitoring", DependsOn: []string{"serviceA/backend", "serviceB/backend"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to build graph: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		selector  Selector
+		want      []string
+		wantError bool
+	}{
+		{
+			name:     "everything by default",
+			selector: Selector{},
+			want:     []string{"serviceA/backend", "serviceB/backend", "shared/iam", "shared/monitoring", "shared/network"},
+		},
+		{
+			name:     "glob target",
+			selector: Selector{Targets: []string{"service*"}},
+			want:     []string{"serviceA/backend", "serviceB/backend"},
+		},
+		{
+			name:     "exclude",
+			selector: Selector{Excludes: []string{"shared"}},
+			want:     []string{"serviceA/backend", "serviceB/backend"},
+		},
+		{
+			name:     "with dependencies",
+			selector: Selector{Targets: []string{"serviceA/backend"}, WithDependencies: true},
+			want:     []string{"serviceA/backend", "shared/iam", "shared/network"},
+		},
+		{
+			name:     "with dependents",
+			selector: Selector{Targets: []string{"shared/network"}, WithDependents: true},
+			want:     []string{"serviceA/backend", "serviceB/backend", "shared/monitoring", "shared/network"},
+		},
+		{
+			name: "exclude wins over expansion",
+			selector: Selector{
+				Targets:          []string{"shared/network"},
+				Excludes:         []string{"shared/monitoring"},
+				WithDependents:   true,
+				WithDependencies: true,
+			},
+			want: []string{"serviceA/backend", "serviceB/backend", "shared/network"},
+		},
+		{
+			name:     "only",
+			selector: Selector{Targets: []string{"shared"}, Only: map[string]bool{"shared/iam": true, "serviceA/backend": true}},
+			want:     []string{"shared/iam"},
+		},
+		{
+			name:     "empty only selects nothing",
+			selector: Selector{Only: map[string]bool{}},
+			want:     nil,
+		},
+		{
+			name:      "target without matches",
+			selector:  Selector{Targets: []string{"serviceC/*"}},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := graph.Select(tt.selector)
+			if tt.wantError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []string
+			for path := range selected {
+				got = append(got, path)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Select() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSelectByTags(t *testing.T) {
+	graph, err := BuildExecutionGraph(&Config{
+		Modules: []Module{
+			{Path: "network", Tags: []string{"platform", "networking"}},
+			{Path: "iam", Tags: []string{"platform"}},
+			{Path: "db", DependsOn: []string{"network"}, Tags: []string{"app", "data", "tier-1"}},
+			{Path: "api", DependsOn: []string{"db", "iam"}, Tags: []string{"app", "tier-1"}},
+			{Path: "batch", DependsOn: []string{"db"}, Tags: []string{"app"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to build graph: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		tags     string
+		skipTags string
+		withDeps bool
+		want     []string
+	}{
+		{name: "single tag", tags: "platform", want: []string{"iam", "network"}},
+		{name: "and expression", tags: "app and tier-1", want: []string{"api", "db"}},
+		{name: "skip tags", skipTags: "data,platform", want: []string{"api", "batch"}},
+		{name: "tags and skip tags", tags: "app", skipTags: "tier-1", want: []string{"batch"}},
+		{name: "skip tags win over expansion", tags: "app", skipTags: "networking", withDeps: true, want: []string{"api", "batch", "db", "iam"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Selector
+			if tt.tags != "" {
+				if s.Tags, err = ParseTagExpr(tt.tags); err != nil {
+					t.Fatalf("failed to parse tags: %v", err)
+				}
+			}
+			if tt.skipTags != "" {
+				if s.SkipTags, err = ParseTagExpr(tt.skipTags); err != nil {
+					t.Fatalf("failed to parse skip tags: %v", err)
+				}
+			}
+			s.WithDependencies = tt.withDeps
+
+			selected, err := graph.Select(s)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []string
+			for path := range selected {
+				got = append(got, path)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Select() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TagExpr is a parsed tag expression that can be matched against the tags of
+// a module.
+type TagExpr interface {
+	Match(tags []string) bool
+	String() string
+}
+
+type tagName string
+
+func (t tagName) Match(tags []string) bool {
+	for _, tag := range tags {
+		if tag == string(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t tagName) String() string { return string(t) }
+
+type tagNot struct{ expr TagExpr }
+
+func (t tagNot) Match(tags []string) bool { return !t.expr.Match(tags) }
+
+func (t tagNot) String() string { return "not " + t.expr.String() }
+
+type tagAnd struct{ left, right TagExpr }
+
+func (t tagAnd) Match(tags []string) bool { return t.left.Match(tags) && t.right.Match(tags) }
+
+func (t tagAnd) String() string { return "(" + t.left.String() + " and " + t.right.String() + ")" }
+
+type tagOr struct{ left, right TagExpr }
+
+func (t tagOr) Match(tags []string) bool { return t.left.Match(tags) || t.right.Match(tags) }
+
+func (t tagOr) String() string { return "(" + t.left.String() + " or " + t.right.String() + ")" }
+
+// ParseTagExpr parses a tag expression. Tags can be combined with "or" (or
+// ","), "and" (or "&") and negated with "not" (or "!"). "and" binds tighter
+// than "or", and parentheses group terms, e.g.
+//
+//	networking,data
+//	tier-1 and not (legacy or experimental)
+func ParseTagExpr(s string) (TagExpr, error) {
+	p := &tagParser{tokens: tokenizeTags(s), input: s}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty tag expression")
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in tag expression %q", p.tokens[p.pos], s)
+	}
+	return expr, nil
+}
+
+func tokenizeTags(s string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case strings.ContainsRune("(),&!|", r):
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type tagParser struct {
+	tokens []string
+	pos    int
+	input  string
+}
+
+func (p *tagParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return strings.ToLower(p.tokens[p.pos])
+	}
+	return ""
+}
+
+func (p *tagParser) parseOr() (TagExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" || p.peek() == "," || p.peek() == "|" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = tagOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *tagParser) parseAnd() (TagExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" || p.peek() == "&" {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = tagAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *tagParser) parseNot() (TagExpr, error) {
+	switch p.peek() {
+	case "not", "!":
+		p.pos++
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return tagNot{expr}, nil
+	case "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis in tag expression %q", p.input)
+		}
+		p.pos++
+		return expr, nil
+	case "", ")", ",", "|", "&", "and", "or":
+		return nil, fmt.Errorf("expected a tag in tag expression %q", p.input)
+	}
+	tag := p.tokens[p.pos]
+	p.pos++
+	return tagName(tag), nil
+}
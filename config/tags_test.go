@@ -0,0 +1,48 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParseTagExpr(t *testing.T) {
+	tests := []struct {
+		expr string
+		tags []string
+		want bool
+	}{
+		{expr: "networking", tags: []string{"networking"}, want: true},
+		{expr: "networking", tags: []string{"data"}, want: false},
+		{expr: "networking,data", tags: []string{"data"}, want: true},
+		{expr: "networking or data", tags: []string{"compute"}, want: false},
+		{expr: "data and tier-1", tags: []string{"data", "tier-1"}, want: true},
+		{expr: "data & tier-1", tags: []string{"data"}, want: false},
+		{expr: "not legacy", tags: nil, want: true},
+		{expr: "!legacy", tags: []string{"legacy"}, want: false},
+		{expr: "networking or data and tier-1", tags: []string{"networking"}, want: true},
+		{expr: "(networking or data) and tier-1", tags: []string{"networking"}, want: false},
+		{expr: "tier-1 and not (legacy or experimental)", tags: []string{"tier-1", "experimental"}, want: false},
+		{expr: "tier-1 AND NOT legacy", tags: []string{"tier-1"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseTagExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := expr.Match(tt.tags); got != tt.want {
+				t.Errorf("%s.Match(%v) = %v, want %v", expr, tt.tags, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTagExprErrors(t *testing.T) {
+	for _, expr := range []string{"", "networking and", "(networking", "networking)", "or data", "a b"} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ParseTagExpr(expr); err == nil {
+				t.Errorf("expected error for %q but got none", expr)
+			}
+		})
+	}
+}
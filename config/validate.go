@@ -0,0 +1,201 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Kinds of problems reported by Validate.
+const (
+	ProblemDuplicatePath     = "duplicate_path"
+	ProblemSelfDependency    = "self_dependency"
+	ProblemUnknownDependency = "unknown_dependency"
+	ProblemCycle             = "cycle"
+	ProblemMissingDirectory  = "missing_directory"
+	ProblemNoTerraformFiles  = "no_terraform_files"
+	ProblemInvalidTimeout    = "invalid_timeout"
+	ProblemInvalidRetry      = "invalid_retry"
+	ProblemInvalidDocker     = "invalid_docker"
+	ProblemInvalidVersion    = "invalid_version"
+)
+
+// Problem describes a single issue found in a config.
+type Problem struct {
+	Kind    string   `json:"kind"`
+	Module  string   `json:"module,omitempty"`
+	Message string   `json:"message"`
+	Cycle   []string `json:"cycle,omitempty"`
+}
+
+// Validate checks cfg and returns every problem it finds rather than
+// stopping at the first one. It covers the module definitions, the
+// dependency graph and the module directories under BasePath.
+func Validate(cfg *Config) []Problem {
+	problems := ValidateGraph(cfg)
+	return append(problems, ValidateDirectories(cfg)...)
+}
+
+// ValidateGraph reports an invalid docker setting, invalid version
+// constraints, duplicate module paths, negative timeouts, invalid retry
+// policies, self-dependencies, unknown dependencies and dependency cycles.
+func ValidateGraph(cfg *Config) []Problem {
+	var problems []Problem
+
+	for _, msg := range cfg.Docker.validate() {
+		problems = append(problems, Problem{
+			Kind:    ProblemInvalidDocker,
+			Message: "docker: " + msg,
+		})
+	}
+	if _, err := ParseVersionConstraint(cfg.RequiredVersion); cfg.RequiredVersion != "" && err != nil {
+		problems = append(problems, Problem{
+			Kind:    ProblemInvalidVersion,
+			Message: "required_version: " + err.Error(),
+		})
+	}
+
+	for _, msg := range cfg.Retry.validate() {
+		problems = append(problems, Problem{
+			Kind:    ProblemInvalidRetry,
+			Message: "retry: " + msg,
+		})
+	}
+
+	defined := make(map[string]bool, len(cfg.Modules))
+	for _, mod := range cfg.Modules {
+		if defined[mod.Path] {
+			problems = append(problems, Problem{
+				Kind:    ProblemDuplicatePath,
+				Module:  mod.Path,
+				Message: fmt.Sprintf("module %s is defined more than once", mod.Path),
+			})
+		}
+		defined[mod.Path] = true
+
+		if mod.Timeout < 0 {
+			problems = append(problems, Problem{
+				Kind:    ProblemInvalidTimeout,
+				Module:  mod.Path,
+				Message: fmt.Sprintf("module %s has a negative timeout %s", mod.Path, mod.Timeout),
+			})
+		}
+		for _, msg := range mod.Retry.validate() {
+			problems = append(problems, Problem{
+				Kind:    ProblemInvalidRetry,
+				Module:  mod.Path,
+				Message: fmt.Sprintf("module %s retry: %s", mod.Path, msg),
+			})
+		}
+		if _, err := ParseVersionConstraint(mod.RequiredVersion); mod.RequiredVersion != "" && err != nil {
+			problems = append(problems, Problem{
+				Kind:    ProblemInvalidVersion,
+				Module:  mod.Path,
+				Message: fmt.Sprintf("module %s required_version: %v", mod.Path, err),
+			})
+		}
+	}
+
+	for _, mod := range cfg.Modules {
+		for _, dep := range mod.DependsOn {
+			switch {
+			case dep == mod.Path:
+				problems = append(problems, Problem{
+					Kind:    ProblemSelfDependency,
+					Module:  mod.Path,
+					Message: fmt.Sprintf("module %s depends on itself", mod.Path),
+				})
+			case !defined[dep]:
+				problems = append(problems, Problem{
+					Kind:    ProblemUnknownDependency,
+					Module:  mod.Path,
+					Message: fmt.Sprintf("unknown dependency %s for module %s", dep, mod.Path),
+				})
+			}
+		}
+	}
+
+	graph, err := BuildExecutionGraph(cfg)
+	if err != nil {
+		return problems
+	}
+	for _, cycle := range graph.Cycles() {
+		if len(cycle) == 2 {
+			// Reported above as a self-dependency.
+			continue
+		}
+		problems = append(problems, Problem{
+			Kind:    ProblemCycle,
+			Module:  cycle[0],
+			Message: fmt.Sprintf("cyclic dependency: %s", strings.Join(cycle, " -> ")),
+			Cycle:   cycle,
+		})
+	}
+
+	return problems
+}
+
+// configFilePatterns match the files Terraform and OpenTofu load a module
+// from.
+var configFilePatterns = []string{"*.tf", "*.tf.json", "*.tofu", "*.tofu.json"}
+
+// hasConfigFiles reports whether dir holds a file matching
+// configFilePatterns.
+func hasConfigFiles(dir string) bool {
+	for _, pattern := range configFilePatterns {
+		if files, err := filepath.Glob(filepath.Join(dir, pattern)); err == nil && len(files) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateDirectories reports modules whose directory under BasePath does
+// not exist or contains no configuration files, and version files that pin
+// no valid version.
+func ValidateDirectories(cfg *Config) []Problem {
+	var problems []Problem
+	checked := make(map[string]bool, len(cfg.Modules))
+
+	for _, mod := range cfg.Modules {
+		if checked[mod.Path] {
+			continue
+		}
+		checked[mod.Path] = true
+
+		dir := filepath.Join(cfg.BasePath, mod.Path)
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			problems = append(problems, Problem{
+				Kind:    ProblemMissingDirectory,
+				Module:  mod.Path,
+				Message: fmt.Sprintf("module directory %s does not exist", dir),
+			})
+			continue
+		}
+
+		if !hasConfigFiles(dir) {
+			problems = append(problems, Problem{
+				Kind:    ProblemNoTerraformFiles,
+				Module:  mod.Path,
+				Message: fmt.Sprintf("module directory %s contains no .tf, .tf.json, .tofu or .tofu.json files", dir),
+			})
+		}
+
+		pinned, path, err := findVersionFile(dir, cfg.BasePath)
+		if err == nil && pinned != "" {
+			_, err = ParseVersionConstraint(pinned)
+		}
+		if err != nil {
+			problems = append(problems, Problem{
+				Kind:    ProblemInvalidVersion,
+				Module:  mod.Path,
+				Message: fmt.Sprintf("module %s: %s: %v", mod.Path, cmp.Or(path, VersionFile), err),
+			})
+		}
+	}
+
+	return problems
+}
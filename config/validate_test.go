@@ -0,0 +1,200 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateGraph(t *testing.T) {
+	tests := []struct {
+		name    string
+		retry   *Retry
+		docker  *Docker
+		version string
+		modules []Module
+		want    []Problem
+	}{
+		{
+			name: "valid config",
+			modules: []Module{
+				{Path: "a"},
+				{Path: "b", DependsOn: []string{"a"}},
+			},
+			want: nil,
+		},
+		{
+			name: "every problem reported at once",
+			modules: []Module{
+				{Path: "a", DependsOn: []string{"b"}},
+				{Path: "b", DependsOn: []string{"c", "missing"}},
+				{Path: "c", DependsOn: []string{"a"}},
+				{Path: "d", DependsOn: []string{"d"}},
+				{Path: "a", DependsOn: []string{"b"}},
+			},
+			want: []Problem{
+				{Kind: ProblemDuplicatePath, Module: "a", Message: "module a is defined more than once"},
+				{Kind: ProblemUnknownDependency, Module: "b", Message: "unknown dependency missing for module b"},
+				{Kind: ProblemSelfDependency, Module: "d", Message: "module d depends on itself"},
+				{
+					Kind:    ProblemCycle,
+					Module:  "a",
+					Message: "cyclic dependency: a -> b -> c -> a",
+					Cycle:   []string{"a", "b", "c", "a"},
+				},
+			},
+		},
+		{
+			name: "negative timeout",
+			modules: []Module{
+				{Path: "a", Timeout: -time.Minute},
+				{Path: "b", Timeout: time.Minute},
+			},
+			want: []Problem{
+				{Kind: ProblemInvalidTimeout, Module: "a", Message: "module a has a negative timeout -1m0s"},
+			},
+		},
+		{
+			name:  "invalid retry policies",
+			retry: &Retry{MaxAttempts: -1},
+			modules: []Module{
+				{Path: "a", Retry: &Retry{Backoff: -time.Second, Patterns: []string{"ok", "("}}},
+			},
+			want: []Problem{
+				{Kind: ProblemInvalidRetry, Message: "retry: negative max_attempts -1"},
+				{Kind: ProblemInvalidRetry, Module: "a", Message: "module a retry: negative backoff -1s"},
+				{Kind: ProblemInvalidRetry, Module: "a", Message: "module a retry: invalid pattern \"(\": error parsing regexp: missing closing ): `(`"},
+			},
+		},
+		{
+			name:    "invalid docker setting",
+			docker:  &Docker{Env: []string{"AWS_REGION", "AWS_PROFILE=dev"}},
+			modules: []Module{{Path: "a"}},
+			want: []Problem{
+				{Kind: ProblemInvalidDocker, Message: "docker: image is required"},
+				{Kind: ProblemInvalidDocker, Message: "docker: invalid env variable name \"AWS_PROFILE=dev\""},
+			},
+		},
+		{
+			name:    "invalid version constraints",
+			version: ">= 1.5,",
+			modules: []Module{
+				{Path: "a", RequiredVersion: "~> 1.5"},
+				{Path: "b", RequiredVersion: "1.x"},
+			},
+			want: []Problem{
+				{Kind: ProblemInvalidVersion, Message: "required_version: invalid version constraint \">= 1.5,\""},
+				{Kind: ProblemInvalidVersion, Module: "b", Message: "module b required_version: invalid version constraint \"1.x\""},
+			},
+		},
+		{
+			name: "several cycles through one module",
+			modules: []Module{
+				{Path: "a", DependsOn: []string{"b", "c"}},
+				{Path: "b", DependsOn: []string{"a"}},
+				{Path: "c", DependsOn: []string{"a"}},
+			},
+			want: []Problem{
+				{Kind: ProblemCycle, Module: "a", Message: "cyclic dependency: a -> b -> a", Cycle: []string{"a", "b", "a"}},
+				{Kind: ProblemCycle, Module: "a", Message: "cyclic dependency: a -> c -> a", Cycle: []string{"a", "c", "a"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateGraph(&Config{Modules: tt.modules, Retry: tt.retry, Docker: tt.docker, RequiredVersion: tt.version})
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ValidateGraph() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateDirectories(t *testing.T) {
+	base := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(base, "ok"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "ok", "main.tf"), []byte(""), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(base, "empty"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(base, "pinned"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "pinned", "main.tf"), []byte(""), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "pinned", VersionFile), []byte("latest\n"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	for _, file := range []string{"json/main.tf.json", "tofu/main.tofu"} {
+		if err := os.MkdirAll(filepath.Join(base, filepath.Dir(file)), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(base, file), []byte(""), 0644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+	}
+
+	cfg := &Config{
+		BasePath: base,
+		Modules: []Module{
+			{Path: "ok"},
+			{Path: "json"},
+			{Path: "tofu"},
+			{Path: "empty"},
+			{Path: "missing"},
+			{Path: "pinned"},
+		},
+	}
+
+	got := ValidateDirectories(cfg)
+	want := []Problem{
+		{
+			Kind:    ProblemNoTerraformFiles,
+			Module:  "empty",
+			Message: "module directory " + filepath.Join(base, "empty") + " contains no .tf, .tf.json, .tofu or .tofu.json files",
+		},
+		{
+			Kind:    ProblemMissingDirectory,
+			Module:  "missing",
+			Message: "module directory " + filepath.Join(base, "missing") + " does not exist",
+		},
+		{
+			Kind:    ProblemInvalidVersion,
+			Module:  "pinned",
+			Message: "module pinned: " + filepath.Join(base, "pinned", VersionFile) + ": invalid version constraint \"latest\"",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ValidateDirectories() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCyclicDependencyErrorShowsChain(t *testing.T) {
+	graph, err := BuildExecutionGraph(&Config{
+		Modules: []Module{
+			{Path: "app", DependsOn: []string{"a"}},
+			{Path: "a", DependsOn: []string{"b"}},
+			{Path: "b", DependsOn: []string{"a"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to build graph: %v", err)
+	}
+
+	_, err = graph.TopoSortedModules()
+	if err == nil {
+		t.Fatal("expected cyclic dependency error but got none")
+	}
+	if want := "cyclic dependency detected: a -> b -> a"; err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// VersionFile is the file, as used by tfenv, that pins the terraform
+// version of the modules in its directory and below.
+const VersionFile = ".terraform-version"
+
+// Version is a terraform version such as 1.5.7 or 1.9.0-beta1.
+type Version struct {
+	Major, Minor, Patch int
+	// Pre is the pre-release part, without the dash.
+	Pre string
+}
+
+// ParseVersion parses a version with up to three numeric parts, an
+// optional leading v and an optional pre-release part. Missing parts are
+// zero.
+func ParseVersion(s string) (Version, error) {
+	v, _, err := parseVersion(s)
+	return v, err
+}
+
+// parseVersion is ParseVersion that also returns how many numeric parts s
+// has.
+func parseVersion(s string) (Version, int, error) {
+	var v Version
+	core := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	core, v.Pre, _ = strings.Cut(core, "-")
+	parts := strings.Split(core, ".")
+	if core == "" || len(parts) > 3 {
+		return Version{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, 0, fmt.Errorf("invalid version %q", s)
+		}
+		*nums[i] = n
+	}
+	return v, len(parts), nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v is older than, the same as or newer than
+// o. A pre-release is older than the release it precedes.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		switch {
+		case d < 0:
+			return -1
+		case d > 0:
+			return 1
+		}
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	case v.Pre < o.Pre:
+		return -1
+	}
+	return 1
+}
+
+// VersionConstraint is a list of terms that a version must all satisfy,
+// written like terraform's required_version, such as ">= 1.5, < 1.10" or
+// "~> 1.5.0".
+type VersionConstraint []versionTerm
+
+type versionTerm struct {
+	op      string
+	version Version
+	// parts is the number of numeric parts written, which decides the
+	// upper bound of ~>.
+	parts int
+}
+
+// ParseVersionConstraint parses a comma-separated list of terms, each an
+// operator (=, !=, >, >=, <, <= or ~>) followed by a version. A version
+// without an operator must match exactly.
+func ParseVersionConstraint(s string) (VersionConstraint, error) {
+	var c VersionConstraint
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		op := ""
+		for _, candidate := range []string{"~>", ">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(term, candidate) {
+				op = candidate
+				break
+			}
+		}
+		v, parts, err := parseVersion(strings.TrimPrefix(term, op))
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q", s)
+		}
+		if op == "" {
+			op = "="
+		}
+		c = append(c, versionTerm{op: op, version: v, parts: parts})
+	}
+	return c, nil
+}
+
+// Allows reports whether v satisfies every term of c. For ~> the last
+// written part may increase: ~> 1.5 allows 1.x from 1.5 on, and ~> 1.5.2
+// allows 1.5.x from 1.5.2 on.
+func (c VersionConstraint) Allows(v Version) bool {
+	for _, t := range c {
+		cmp := v.Compare(t.version)
+		ok := false
+		switch t.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case "~>":
+			upper := Version{Major: t.version.Major + 1}
+			if t.parts == 3 {
+				upper = Version{Major: t.version.Major, Minor: t.version.Minor + 1}
+			}
+			ok = cmp >= 0 && v.Compare(upper) < 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// requiredVersionFor returns the version constraint of mod: its own
+// required_version, else the version pinned by the nearest version file
+// between the module directory and base_path, else the config's
+// required_version.
+func (c *Config) requiredVersionFor(mod Module) (string, error) {
+	if mod.RequiredVersion != "" {
+		return mod.RequiredVersion, nil
+	}
+	pinned, _, err := findVersionFile(filepath.Join(c.BasePath, mod.Path), c.BasePath)
+	if err != nil {
+		return "", err
+	}
+	if pinned != "" {
+		return pinned, nil
+	}
+	return c.RequiredVersion, nil
+}
+
+// findVersionFile looks for a version file in dir and its parents up to
+// and including stop, and returns the version it pins and its path. It
+// returns an empty version if there is none.
+func findVersionFile(dir, stop string) (string, string, error) {
+	dir, stop = filepath.Clean(dir), filepath.Clean(stop)
+	for {
+		path := filepath.Join(dir, VersionFile)
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return strings.TrimSpace(string(data)), path, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", "", err
+		}
+		if dir == stop {
+			return "", "", nil
+		}
+		rel, err := filepath.Rel(stop, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", "", nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Version
+		wantErr bool
+	}{
+		{in: "1.5.7", want: Version{Major: 1, Minor: 5, Patch: 7}},
+		{in: "v1.9.0-beta1", want: Version{Major: 1, Minor: 9, Pre: "beta1"}},
+		{in: "1.5", want: Version{Major: 1, Minor: 5}},
+		{in: " 1.10.2\n", want: Version{Major: 1, Minor: 10, Patch: 2}},
+		{in: "", wantErr: true},
+		{in: "1.x", wantErr: true},
+		{in: "1.2.3.4", wantErr: true},
+		{in: "latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseVersion(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseVersion(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVersionConstraintAllows(t *testing.T) {
+	tests := []struct {
+		constraint string
+		allowed    []string
+		denied     []string
+	}{
+		{constraint: "1.5.7", allowed: []string{"1.5.7"}, denied: []string{"1.5.6", "1.5.8", "1.5.7-rc1"}},
+		{constraint: ">= 1.5, < 1.10", allowed: []string{"1.5.0", "1.9.8"}, denied: []string{"1.4.9", "1.10.0"}},
+		{constraint: "~> 1.5", allowed: []string{"1.5.0", "1.9.5"}, denied: []string{"1.4.7", "2.0.0"}},
+		{constraint: "~> 1.5.2", allowed: []string{"1.5.2", "1.5.9"}, denied: []string{"1.5.1", "1.6.0"}},
+		{constraint: "!= 1.6.0, > 1.5", allowed: []string{"1.6.1"}, denied: []string{"1.6.0", "1.5.0"}},
+		{constraint: "<= 1.9.0", allowed: []string{"1.9.0", "1.9.0-beta1"}, denied: []string{"1.9.1"}},
+	}
+	for _, tt := range tests {
+		c, err := ParseVersionConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("ParseVersionConstraint(%q): unexpected error: %v", tt.constraint, err)
+			continue
+		}
+		for _, s := range tt.allowed {
+			if v, _ := ParseVersion(s); !c.Allows(v) {
+				t.Errorf("expected %q to allow %s", tt.constraint, s)
+			}
+		}
+		for _, s := range tt.denied {
+			if v, _ := ParseVersion(s); c.Allows(v) {
+				t.Errorf("expected %q to deny %s", tt.constraint, s)
+			}
+		}
+	}
+
+	for _, s := range []string{"", ">= 1.5,", "=> 1.5", "~> latest"} {
+		if _, err := ParseVersionConstraint(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestRequiredVersion(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "envs", "dev")
+	for _, dir := range []string{"legacy/db", "legacy/cache", "app", "pinned"} {
+		if err := os.MkdirAll(filepath.Join(base, dir), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+	}
+	for path, content := range map[string]string{
+		filepath.Join(base, "legacy", VersionFile):          "1.5.7\n",
+		filepath.Join(base, "legacy", "cache", VersionFile): "1.5.5\n",
+		filepath.Join(base, "..", VersionFile):              "1.3.0\n",
+		filepath.Join(base, "pinned", VersionFile):          "1.8.0\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+	}
+
+	graph, err := BuildExecutionGraph(&Config{
+		BasePath:        base,
+		RequiredVersion: "~> 1.9",
+		Modules: []Module{
+			{Path: "legacy/db"},
+			{Path: "legacy/cache"},
+			{Path: "app"},
+			{Path: "pinned", RequiredVersion: ">= 1.9"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to build graph: %v", err)
+	}
+
+	got := map[string]string{}
+	for path, node := range graph.Nodes {
+		got[path] = node.RequiredVersion
+	}
+	want := map[string]string{
+		"legacy/db":    "1.5.7",
+		"legacy/cache": "1.5.5",
+		// The version file above base_path is not used.
+		"app":    "~> 1.9",
+		"pinned": ">= 1.9",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("required versions mismatch (-want +got):\n%s", diff)
+	}
+}
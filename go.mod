@@ -4,7 +4,7 @@ go 1.24.2
 
 require github.com/spf13/cobra v1.9.1
 
-require github.com/google/go-cmp v0.7.0 // indirect
+require github.com/google/go-cmp v0.7.0
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
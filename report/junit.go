@@ -0,0 +1,124 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// JUnit XML elements, following the format most CI systems read.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Output  string `xml:",cdata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes r to w as JUnit XML. Each module is a test case named
+// after its path in a suite named after the command. Failed, interrupted and
+// timed out modules carry their error and captured output, modules that did
+// not run or were already applied are skipped, and the output of the other
+// modules goes to system-out.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      "terracotta " + r.Command,
+		Time:      seconds(r.Duration),
+		Timestamp: r.StartedAt.Format("2006-01-02T15:04:05"),
+	}
+	for _, m := range r.Modules {
+		tc := junitTestCase{
+			Name:      m.Path,
+			Classname: "terracotta." + r.Command,
+			Time:      seconds(m.Duration),
+		}
+		switch m.Status {
+		case StatusFailed:
+			tc.Failure = &junitFailure{Message: m.Error, Output: plainText(m.Output)}
+			suite.Failures++
+		case StatusInterrupted:
+			tc.Failure = &junitFailure{Message: "interrupted: " + m.Error, Output: plainText(m.Output)}
+			suite.Failures++
+		case StatusTimedOut:
+			tc.Failure = &junitFailure{Message: "timed out: " + m.Error, Output: plainText(m.Output)}
+			suite.Failures++
+		case StatusSkipped:
+			tc.Skipped = &junitSkipped{Message: "skipped after a failure"}
+			suite.Skipped++
+		case StatusNotSelected:
+			tc.Skipped = &junitSkipped{Message: "not selected"}
+			suite.Skipped++
+		case StatusAlreadyApplied:
+			tc.Skipped = &junitSkipped{Message: "already applied in an earlier run"}
+			suite.Skipped++
+		default:
+			if m.Output != "" {
+				tc.SystemOut = &junitOutput{Text: plainText(m.Output)}
+			}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Tests = len(suite.Cases)
+
+	doc := junitTestSuites{
+		Name:     "terracotta",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteJUnitFile writes r as JUnit XML to the file at path.
+func (r *Report) WriteJUnitFile(path string) error {
+	return writeFile(path, r.WriteJUnit)
+}
+
+func seconds(d float64) string {
+	return fmt.Sprintf("%.3f", d)
+}
@@ -0,0 +1,62 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	rep := sampleReport()
+	rep.Modules[0].Output = "[shared/network] Plan: 3 to add\n"
+	rep.Modules[1].Output = "[serviceA/backend] \x1b[31mError:\x1b[0m <invalid> & ]]> broken\x00\n"
+
+	var buf bytes.Buffer
+	if err := rep.WriteJUnit(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("expected XML header, got %q", buf.String())
+	}
+
+	var got junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("report is not valid XML: %v", err)
+	}
+	if got.Tests != 3 || got.Failures != 1 || got.Skipped != 1 || got.Time != "90.000" {
+		t.Errorf("unexpected totals: tests=%d failures=%d skipped=%d time=%s", got.Tests, got.Failures, got.Skipped, got.Time)
+	}
+	if len(got.Suites) != 1 {
+		t.Fatalf("expected 1 suite, got %d", len(got.Suites))
+	}
+
+	want := []junitTestCase{
+		{
+			Name:      "shared/network",
+			Classname: "terracotta.plan",
+			Time:      "90.000",
+			SystemOut: &junitOutput{Text: "[shared/network] Plan: 3 to add\n"},
+		},
+		{
+			Name:      "serviceA/backend",
+			Classname: "terracotta.plan",
+			Time:      "0.000",
+			Failure: &junitFailure{
+				Message: "plan failed: exit status 1",
+				Output:  "[serviceA/backend] Error: <invalid> & ]]> broken\n",
+			},
+		},
+		{
+			Name:      "serviceB/backend",
+			Classname: "terracotta.plan",
+			Time:      "0.000",
+			Skipped:   &junitSkipped{Message: "not selected"},
+		},
+	}
+	if diff := cmp.Diff(want, got.Suites[0].Cases); diff != "" {
+		t.Errorf("test cases mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,171 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DefaultMarkdownMaxSize keeps Markdown reports under the 65536 character
+// limit of GitHub comments, with room for a header added by the poster.
+const DefaultMarkdownMaxSize = 60000
+
+// markdownStatus is how each status is shown in the summary table.
+var markdownStatus = map[string]string{
+	StatusSuccess:        "✔ success",
+	StatusChanges:        "± changes",
+	StatusNoChanges:      "✔ no changes",
+	StatusUnchanged:      "✔ no changes, skipped",
+	StatusFailed:         "✖ failed",
+	StatusSkipped:        "⏭ skipped",
+	StatusInterrupted:    "⏹ interrupted",
+	StatusTimedOut:       "⏱ timed out",
+	StatusAlreadyApplied: "✔ already applied",
+	StatusNotSelected:    "not selected",
+}
+
+// WriteMarkdown writes r to w as Markdown: a summary table followed by a
+// collapsible section with the output of every module that ran. If the
+// document would be larger than maxSize bytes, the largest sections are
+// shortened first, keeping the end of their output where terraform prints
+// its summary. A maxSize of 0 or less means no limit.
+func (r *Report) WriteMarkdown(w io.Writer, maxSize int) error {
+	outputs := make([]string, len(r.Modules))
+	for i, m := range r.Modules {
+		outputs[i] = markdownOutput(m)
+	}
+
+	doc := r.renderMarkdown(outputs, nil)
+	if maxSize > 0 && len(doc) > maxSize {
+		doc = r.renderMarkdown(shrinkOutputs(outputs, len(doc)-maxSize), outputs)
+	}
+	_, err := io.WriteString(w, doc)
+	return err
+}
+
+// WriteMarkdownFile writes r as Markdown to the file at path.
+func (r *Report) WriteMarkdownFile(path string, maxSize int) error {
+	return writeFile(path, func(w io.Writer) error {
+		return r.WriteMarkdown(w, maxSize)
+	})
+}
+
+// renderMarkdown renders the document with the given module outputs. When
+// full is set, sections whose output is shorter than in full say how much
+// was left out.
+func (r *Report) renderMarkdown(outputs, full []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## terracotta %s: %s\n\n", r.Command, r.Status)
+	if r.Changes != nil {
+		fmt.Fprintf(&b, "**Total:** %d to add, %d to change, %d to destroy\n\n", r.Changes.Add, r.Changes.Change, r.Changes.Destroy)
+	}
+
+	b.WriteString("| Module | Status | Add | Change | Destroy |\n")
+	b.WriteString("|--------|--------|----:|-------:|--------:|\n")
+	for _, m := range r.Modules {
+		add, change, destroy := "", "", ""
+		if m.Changes != nil {
+			add, change, destroy = fmt.Sprint(m.Changes.Add), fmt.Sprint(m.Changes.Change), fmt.Sprint(m.Changes.Destroy)
+		}
+		status, ok := markdownStatus[m.Status]
+		if !ok {
+			status = m.Status
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s |\n", m.Path, status, add, change, destroy)
+	}
+
+	for i, m := range r.Modules {
+		if outputs[i] == "" && (full == nil || full[i] == "") {
+			continue
+		}
+		fmt.Fprintf(&b, "\n<details><summary><code>%s</code> (%s)</summary>\n\n", m.Path, m.Status)
+		if full != nil && len(outputs[i]) < len(full[i]) {
+			fmt.Fprintf(&b, "_Output truncated, %d bytes omitted._\n\n", len(full[i])-len(outputs[i]))
+		}
+		if outputs[i] != "" {
+			fence := codeFence(outputs[i])
+			fmt.Fprintf(&b, "%s\n%s%s\n\n", fence, outputs[i], fence)
+		}
+		b.WriteString("</details>\n")
+	}
+	return b.String()
+}
+
+// truncationNote is an upper bound on the size of the note added to a
+// shortened section.
+const truncationNote = len("_Output truncated, 0000000000 bytes omitted._\n\n")
+
+// shrinkOutputs returns outputs shortened by at least excess bytes in
+// total. Outputs are cut to a common length limit, so the longest ones are
+// cut first and short sections stay complete as long as possible.
+func shrinkOutputs(outputs []string, excess int) []string {
+	longest := 0
+	for _, s := range outputs {
+		longest = max(longest, len(s))
+	}
+
+	// removed is the number of bytes saved by a limit, counting the note
+	// each cut section gets. Find the largest limit that saves enough.
+	removed := func(limit int) int {
+		n := 0
+		for _, s := range outputs {
+			if len(s) > limit {
+				n += len(s) - limit - truncationNote
+			}
+		}
+		return n
+	}
+	limit := sort.Search(longest+1, func(l int) bool {
+		return removed(longest-l) >= excess
+	})
+	limit = max(longest-limit, 0)
+
+	shrunk := make([]string, len(outputs))
+	for i, s := range outputs {
+		shrunk[i] = tail(s, limit)
+	}
+	return shrunk
+}
+
+// tail returns the end of s, at most limit bytes long and starting at a line
+// boundary.
+func tail(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	s = s[len(s)-limit:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return ""
+}
+
+// markdownOutput returns the output of m for a Markdown section, without
+// color codes and without the module prefix on each line.
+func markdownOutput(m Module) string {
+	prefix := "[" + m.Path + "] "
+	lines := strings.SplitAfter(plainText(m.Output), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, prefix)
+	}
+	text := strings.Join(lines, "")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text
+}
+
+// codeFence returns a backtick fence longer than any run of backticks in s.
+func codeFence(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
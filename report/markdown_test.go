@@ -0,0 +1,88 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	rep := sampleReport()
+	rep.Modules[0].Output = "[shared/network] \x1b[1mPlan:\x1b[0m 3 to add, 1 to change, 2 to destroy.\n"
+	rep.Modules[1].Output = "[serviceA/backend] Error: ```quoted```"
+
+	var buf bytes.Buffer
+	if err := rep.WriteMarkdown(&buf, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "## terracotta plan: failed\n" +
+		"\n" +
+		"**Total:** 3 to add, 1 to change, 2 to destroy\n" +
+		"\n" +
+		"| Module | Status | Add | Change | Destroy |\n" +
+		"|--------|--------|----:|-------:|--------:|\n" +
+		"| `shared/network` | ± changes | 3 | 1 | 2 |\n" +
+		"| `serviceA/backend` | ✖ failed |  |  |  |\n" +
+		"| `serviceB/backend` | not selected |  |  |  |\n" +
+		"\n" +
+		"<details><summary><code>shared/network</code> (changes)</summary>\n" +
+		"\n" +
+		"```\n" +
+		"Plan: 3 to add, 1 to change, 2 to destroy.\n" +
+		"```\n" +
+		"\n" +
+		"</details>\n" +
+		"\n" +
+		"<details><summary><code>serviceA/backend</code> (failed)</summary>\n" +
+		"\n" +
+		"````\n" +
+		"Error: ```quoted```\n" +
+		"````\n" +
+		"\n" +
+		"</details>\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("markdown mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteMarkdownTruncatesLargestSectionsFirst(t *testing.T) {
+	lines := func(prefix string, n int) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			b.WriteString(prefix + " line\n")
+		}
+		return b.String()
+	}
+
+	rep := sampleReport()
+	rep.Modules[0].Output = lines("[shared/network] big", 500)
+	rep.Modules[1].Output = lines("[serviceA/backend] small", 5) + "[serviceA/backend] Plan: 1 to add\n"
+
+	var full bytes.Buffer
+	if err := rep.WriteMarkdown(&full, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	maxSize := full.Len() / 2
+
+	var buf bytes.Buffer
+	if err := rep.WriteMarkdown(&buf, maxSize); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := buf.String()
+
+	if buf.Len() > maxSize {
+		t.Errorf("expected at most %d bytes, got %d", maxSize, buf.Len())
+	}
+	if !strings.Contains(got, lines("small", 5)+"Plan: 1 to add\n") {
+		t.Errorf("expected the small section to stay complete:\n%s", got)
+	}
+	if strings.Count(got, "Output truncated") != 1 {
+		t.Errorf("expected exactly one truncated section:\n%s", got)
+	}
+	if !strings.Contains(got, "big line\n```") {
+		t.Errorf("expected the end of the large section to be kept:\n%s", got)
+	}
+}
@@ -0,0 +1,141 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Version is the version of the report format. It is bumped whenever a
+// field is removed or changes meaning; new fields may be added without a
+// version change.
+const Version = 1
+
+// Module statuses.
+const (
+	StatusSuccess     = "success"
+	StatusChanges     = "changes"
+	StatusNoChanges   = "no_changes"
+	StatusUnchanged   = "unchanged"
+	StatusFailed      = "failed"
+	StatusSkipped     = "skipped"
+	StatusInterrupted = "interrupted"
+	StatusTimedOut    = "timed_out"
+	StatusNotSelected = "not_selected"
+	// StatusAlreadyApplied marks a module that a resumed apply did not run
+	// because the earlier run already applied it.
+	StatusAlreadyApplied = "already_applied"
+)
+
+// Report describes one plan, apply or destroy run.
+type Report struct {
+	Version int    `json:"version"`
+	Command string `json:"command"`
+	Config  string `json:"config"`
+	// RunID identifies the apply run, for apply --resume.
+	RunID      string    `json:"run_id,omitempty"`
+	Status     string    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Duration   float64   `json:"duration_seconds"`
+	Changes    *Changes  `json:"changes,omitempty"`
+	// Binaries are the terraform-compatible binaries the modules ran.
+	Binaries []Binary `json:"binaries,omitempty"`
+	Modules  []Module `json:"modules"`
+}
+
+// Binary describes a terraform-compatible binary. Flavor is terraform,
+// opentofu or unknown.
+type Binary struct {
+	Binary  string `json:"binary"`
+	Flavor  string `json:"flavor"`
+	Version string `json:"version,omitempty"`
+}
+
+// Module describes the result of one module. Modules that did not run have
+// no timing or commands.
+type Module struct {
+	Path       string     `json:"path"`
+	Status     string     `json:"status"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Duration   float64    `json:"duration_seconds,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Changes    *Changes   `json:"changes,omitempty"`
+	Commands   []string   `json:"commands,omitempty"`
+	LogFile    string     `json:"log_file,omitempty"`
+	// Attempts is the largest number of attempts any step took, when a
+	// step was retried.
+	Attempts int `json:"attempts,omitempty"`
+	// BlockedBy is the failed module that kept a skipped module from
+	// starting.
+	BlockedBy string `json:"blocked_by,omitempty"`
+	// Output is the captured terraform output. It is used by the JUnit
+	// report and left out of the JSON report.
+	Output string `json:"-"`
+}
+
+// Changes counts resource changes in a plan.
+type Changes struct {
+	Add     int `json:"add"`
+	Change  int `json:"change"`
+	Destroy int `json:"destroy"`
+	// Resources lists the changed resource addresses by action.
+	Resources map[string][]string `json:"resources,omitempty"`
+}
+
+// Failed reports whether any module failed or timed out.
+func (r *Report) Failed() bool {
+	for _, m := range r.Modules {
+		if m.Status == StatusFailed || m.Status == StatusTimedOut {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes r to w as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteJSONFile writes r as JSON to the file at path.
+func (r *Report) WriteJSONFile(path string) error {
+	return writeFile(path, r.WriteJSON)
+}
+
+// writeFile creates the file at path and writes it with write.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ansiEscape matches the color codes terraform writes without -no-color.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// plainText removes color codes and other control characters, which are
+// not allowed in XML, from captured output.
+func plainText(s string) string {
+	s = ansiEscape.ReplaceAllString(s, "")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return r
+		case r < 0x20 || r == 0xFFFE || r == 0xFFFF:
+			return -1
+		}
+		return r
+	}, s)
+}
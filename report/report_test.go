@@ -0,0 +1,93 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func sampleReport() *Report {
+	started := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	finished := started.Add(90 * time.Second)
+	return &Report{
+		Version:    Version,
+		Command:    "plan",
+		Config:     "terracotta.yaml",
+		Status:     StatusFailed,
+		StartedAt:  started,
+		FinishedAt: finished,
+		Duration:   90,
+		Changes:    &Changes{Add: 3, Change: 1, Destroy: 2},
+		Modules: []Module{
+			{
+				Path:       "shared/network",
+				Status:     StatusChanges,
+				StartedAt:  &started,
+				FinishedAt: &finished,
+				Duration:   90,
+				Changes:    &Changes{Add: 3, Change: 1, Destroy: 2, Resources: map[string][]string{"create": {"aws_vpc.main"}}},
+				Commands:   []string{"terraform init -input=false", "terraform plan -input=false -detailed-exitcode"},
+			},
+			{Path: "serviceA/backend", Status: StatusFailed, Error: "plan failed: exit status 1"},
+			{Path: "serviceB/backend", Status: StatusNotSelected},
+		},
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleReport().WriteJSON(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	if got["version"] != float64(Version) {
+		t.Errorf("expected version %d, got %v", Version, got["version"])
+	}
+
+	modules := got["modules"].([]any)
+	notSelected := modules[2].(map[string]any)
+	want := map[string]any{"path": "serviceB/backend", "status": StatusNotSelected}
+	if diff := cmp.Diff(want, notSelected); diff != "" {
+		t.Errorf("module mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteJSONFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	want := sampleReport()
+	if err := want.WriteJSONFile(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	var got Report
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to parse report: %v", err)
+	}
+	if diff := cmp.Diff(want, &got); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFailed(t *testing.T) {
+	r := sampleReport()
+	if !r.Failed() {
+		t.Error("expected report with a failed module to be failed")
+	}
+	r.Modules = r.Modules[:1]
+	if r.Failed() {
+		t.Error("expected report without failed modules not to be failed")
+	}
+}
@@ -0,0 +1,76 @@
+package terraform
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+)
+
+// Flavors of terraform-compatible binaries.
+const (
+	FlavorTerraform = "terraform"
+	FlavorOpenTofu  = "opentofu"
+	FlavorUnknown   = "unknown"
+)
+
+// BinaryInfo describes the terraform-compatible binary behind a command.
+type BinaryInfo struct {
+	Binary  string
+	Flavor  string
+	Version string
+}
+
+// String describes the binary as its version output names it, such as
+// "OpenTofu v1.8.0".
+func (b BinaryInfo) String() string {
+	switch b.Flavor {
+	case FlavorTerraform:
+		return "Terraform v" + b.Version
+	case FlavorOpenTofu:
+		return "OpenTofu v" + b.Version
+	}
+	if b.Version != "" {
+		return "v" + b.Version
+	}
+	return "unknown version"
+}
+
+// versionLine matches the line of version output that names the flavor and
+// version. Wrapper scripts may print other lines before it.
+var versionLine = regexp.MustCompile(`(?m)^(Terraform|OpenTofu) v(\S+)`)
+
+// DetectBinary runs binary version -json with r to read the version of the
+// binary, and binary version to read its flavor, which the JSON output does
+// not name. Binaries without JSON output fall back to the version in the
+// plain output. A binary that runs but names neither Terraform nor
+// OpenTofu is reported as FlavorUnknown. The check for newer versions is
+// disabled, so that no network request is made.
+func DetectBinary(ctx context.Context, r Runner, binary string) (BinaryInfo, error) {
+	info := BinaryInfo{Binary: binary, Flavor: FlavorUnknown}
+	env := []string{"CHECKPOINT_DISABLE=1"}
+	output, err := Collect(ctx, r, Invocation{Command: binary, Args: []string{"version", "-json"}, Env: env})
+	if err != nil {
+		return info, err
+	}
+	var v struct {
+		Version string `json:"terraform_version"`
+	}
+	if json.Unmarshal(output, &v) == nil {
+		info.Version = v.Version
+	}
+
+	output, err = Collect(ctx, r, Invocation{Command: binary, Args: []string{"version"}, Env: env})
+	if err != nil {
+		return info, err
+	}
+	if m := versionLine.FindSubmatch(output); m != nil {
+		info.Flavor = FlavorTerraform
+		if string(m[1]) == "OpenTofu" {
+			info.Flavor = FlavorOpenTofu
+		}
+		if info.Version == "" {
+			info.Version = string(m[2])
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,87 @@
+package terraform
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDetectBinary(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		plain   string
+		want    BinaryInfo
+		wantStr string
+	}{
+		{
+			name:    "terraform",
+			json:    `{"terraform_version": "1.9.5", "platform": "linux_amd64"}`,
+			plain:   "Terraform v1.9.5\non linux_amd64\n",
+			want:    BinaryInfo{Flavor: FlavorTerraform, Version: "1.9.5"},
+			wantStr: "Terraform v1.9.5",
+		},
+		{
+			name:    "opentofu",
+			json:    `{"terraform_version": "1.8.0", "platform": "linux_amd64"}`,
+			plain:   "OpenTofu v1.8.0\non linux_amd64\n",
+			want:    BinaryInfo{Flavor: FlavorOpenTofu, Version: "1.8.0"},
+			wantStr: "OpenTofu v1.8.0",
+		},
+		{
+			name:    "wrapper without JSON output",
+			json:    "wrapper 0.1\n",
+			plain:   "wrapper 0.1\nOpenTofu v1.7.2-beta1\n",
+			want:    BinaryInfo{Flavor: FlavorOpenTofu, Version: "1.7.2-beta1"},
+			wantStr: "OpenTofu v1.7.2-beta1",
+		},
+		{
+			name:    "wrapper without version line",
+			json:    `{"terraform_version": "1.6.0"}`,
+			plain:   "wrapper 0.1\n",
+			want:    BinaryInfo{Flavor: FlavorUnknown, Version: "1.6.0"},
+			wantStr: "v1.6.0",
+		},
+		{
+			name:    "unknown tool",
+			json:    "tool 2.0\n",
+			plain:   "tool 2.0\n",
+			want:    BinaryInfo{Flavor: FlavorUnknown},
+			wantStr: "unknown version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &FakeRunner{}
+			f.On("", "version", FakeResponse{Stdout: tt.json, Times: 1})
+			f.On("", "version", FakeResponse{Stdout: tt.plain, Times: 1})
+
+			got, err := DetectBinary(context.Background(), f, "tf")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.want.Binary = "tf"
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+			if got.String() != tt.wantStr {
+				t.Errorf("expected %q, got %q", tt.wantStr, got.String())
+			}
+
+			calls := f.Calls()
+			if diff := cmp.Diff([]string{"version", "-json"}, calls[0].Args); diff != "" {
+				t.Errorf("first call args mismatch (-want +got):\n%s", diff)
+			}
+			if calls[0].Command != "tf" || !cmp.Equal(calls[0].Env, []string{"CHECKPOINT_DISABLE=1"}) {
+				t.Errorf("unexpected call %+v", calls[0])
+			}
+		})
+	}
+
+	f := &FakeRunner{Default: FakeResponse{Err: errors.New("executable file not found in $PATH")}}
+	if _, err := DetectBinary(context.Background(), f, "missing"); err == nil {
+		t.Error("expected an error for a binary that cannot run")
+	}
+}
@@ -0,0 +1,183 @@
+package terraform
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DockerRunner runs every invocation in a new container with docker run.
+// The invocation's Command is the container's entrypoint, so images whose
+// entrypoint is terraform or tofu work as they are. Output and the exit
+// status of the container are those of the command; an interrupt is
+// forwarded to it by the docker client.
+//
+// The container belongs to the docker daemon rather than to the client, so
+// killing the client would leave terraform running and holding its state
+// lock. Every container is therefore given a unique name and killed with
+// docker kill by KillAll, and when a cancelled step ends without it having
+// stopped, such as after the kill that follows a deadline.
+type DockerRunner struct {
+	// Image is the container image.
+	Image string
+	// Docker is the docker client to run. It defaults to docker.
+	Docker string
+	// Root is the host directory mounted at the same path in the container,
+	// normally the working directory, so that relative module sources
+	// resolve as they do on the host. A module directory outside it is
+	// mounted on its own.
+	Root string
+	// PluginCache is a host directory mounted at the same path and used as
+	// TF_PLUGIN_CACHE_DIR, shared by all containers.
+	PluginCache string
+	// Env lists variables passed through from the environment of
+	// terracotta when they are set.
+	Env []string
+	// Files lists files and directories mounted read-only at the same path,
+	// such as credential files.
+	Files []string
+	// User is the user and group the container runs as, such as
+	// "1000:1000", so that files it writes belong to the calling user.
+	User string
+	// Home is set as HOME in the container, so that files under the
+	// calling user's home directory, such as ~/.aws, are found.
+	Home string
+}
+
+func (d DockerRunner) Run(ctx context.Context, inv Invocation) error {
+	name := containerName()
+	args, err := d.dockerArgs(inv, name)
+	if err != nil {
+		return err
+	}
+	docker := d.Docker
+	if docker == "" {
+		docker = "docker"
+	}
+
+	running.Lock()
+	running.containers[name] = docker
+	running.Unlock()
+	defer func() {
+		running.Lock()
+		delete(running.containers, name)
+		running.Unlock()
+	}()
+
+	err = ExecRunner{}.Run(ctx, Invocation{Command: docker, Args: args, Stdout: inv.Stdout, Stderr: inv.Stderr})
+	if ctx.Err() != nil {
+		// The client exits on its own only once the container has stopped,
+		// but it may have been killed while terraform was still running.
+		killContainer(docker, name)
+	}
+	return err
+}
+
+// containerName returns a name for a new container that no other container
+// has.
+func containerName() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "terracotta-" + hex.EncodeToString(b)
+}
+
+// killContainer kills the container with the given name, if it is still
+// running. Being started with --rm, it is then removed by the daemon.
+func killContainer(docker, name string) {
+	cmd := exec.Command(docker, "kill", name)
+	_ = cmd.Run()
+}
+
+// dockerArgs returns the docker run arguments for inv in a container with
+// the given name. Absolute paths in the arguments of inv, such as a plan
+// file written with -out, are made available by mounting their directory
+// at the same path.
+func (d DockerRunner) dockerArgs(inv Invocation, name string) ([]string, error) {
+	root := d.Root
+	if root == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		root = wd
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(inv.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"run", "--rm", "--name", name}
+	if d.User != "" {
+		args = append(args, "--user", d.User)
+	}
+
+	var mounted []string
+	mount := func(path, mode string) {
+		for _, m := range mounted {
+			if within(path, m) {
+				return
+			}
+		}
+		mounted = append(mounted, path)
+		args = append(args, "--volume", path+":"+path+mode)
+	}
+	mount(root, "")
+	mount(dir, "")
+	if d.PluginCache != "" {
+		mount(d.PluginCache, "")
+		args = append(args, "--env", "TF_PLUGIN_CACHE_DIR="+d.PluginCache)
+	}
+	for _, arg := range inv.Args {
+		if path := argPath(arg); path != "" {
+			mount(filepath.Dir(path), "")
+		}
+	}
+	for _, file := range d.Files {
+		mount(file, ":ro")
+	}
+
+	if d.Home != "" {
+		args = append(args, "--env", "HOME="+d.Home)
+	}
+	for _, name := range d.Env {
+		if _, ok := os.LookupEnv(name); ok {
+			args = append(args, "--env", name)
+		}
+	}
+	for _, kv := range inv.Env {
+		args = append(args, "--env", kv)
+	}
+
+	args = append(args, "--workdir", dir, "--entrypoint", inv.command(), d.Image)
+	return append(args, inv.Args...), nil
+}
+
+// argPath returns the absolute path in arg, which is either the path itself
+// or an option such as -out=/tmp/plan, or "" if it holds none.
+func argPath(arg string) string {
+	if strings.HasPrefix(arg, "-") {
+		_, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return ""
+		}
+		arg = value
+	}
+	if !filepath.IsAbs(arg) {
+		return ""
+	}
+	return arg
+}
+
+// within reports whether path is dir or below it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
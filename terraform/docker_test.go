@@ -0,0 +1,181 @@
+package terraform
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDockerArgs(t *testing.T) {
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("TERRACOTTA_TEST_UNSET", "")
+	os.Unsetenv("TERRACOTTA_TEST_UNSET")
+	d := DockerRunner{
+		Image:       "hashicorp/terraform:1.9.5",
+		Root:        "/work",
+		PluginCache: "/home/me/.terraform.d/plugin-cache",
+		Env:         []string{"AWS_REGION", "AWS_PROFILE", "TERRACOTTA_TEST_UNSET"},
+		Files:       []string{"/home/me/.aws"},
+		User:        "1000:1000",
+		Home:        "/home/me",
+	}
+
+	tests := []struct {
+		name string
+		inv  Invocation
+		want []string
+	}{
+		{
+			name: "module inside root",
+			inv:  Invocation{Dir: "/work/envs/dev/network", Args: []string{"init", "-input=false"}},
+			want: []string{
+				"run", "--rm", "--name", "terracotta-test", "--user", "1000:1000",
+				"--volume", "/work:/work",
+				"--volume", "/home/me/.terraform.d/plugin-cache:/home/me/.terraform.d/plugin-cache",
+				"--env", "TF_PLUGIN_CACHE_DIR=/home/me/.terraform.d/plugin-cache",
+				"--volume", "/home/me/.aws:/home/me/.aws:ro",
+				"--env", "HOME=/home/me",
+				"--env", "AWS_REGION",
+				"--env", "AWS_PROFILE",
+				"--workdir", "/work/envs/dev/network",
+				"--entrypoint", "terraform",
+				"hashicorp/terraform:1.9.5",
+				"init", "-input=false",
+			},
+		},
+		{
+			name: "module outside root and plan file",
+			inv: Invocation{
+				Command: "tofu",
+				Dir:     "/srv/stacks/network",
+				Args:    []string{"plan", "-detailed-exitcode", "-out=/tmp/terracotta-plan-1/network/tfplan"},
+				Env:     []string{"CHECKPOINT_DISABLE=1"},
+			},
+			want: []string{
+				"run", "--rm", "--name", "terracotta-test", "--user", "1000:1000",
+				"--volume", "/work:/work",
+				"--volume", "/srv/stacks/network:/srv/stacks/network",
+				"--volume", "/home/me/.terraform.d/plugin-cache:/home/me/.terraform.d/plugin-cache",
+				"--env", "TF_PLUGIN_CACHE_DIR=/home/me/.terraform.d/plugin-cache",
+				"--volume", "/tmp/terracotta-plan-1/network:/tmp/terracotta-plan-1/network",
+				"--volume", "/home/me/.aws:/home/me/.aws:ro",
+				"--env", "HOME=/home/me",
+				"--env", "AWS_REGION",
+				"--env", "AWS_PROFILE",
+				"--env", "CHECKPOINT_DISABLE=1",
+				"--workdir", "/srv/stacks/network",
+				"--entrypoint", "tofu",
+				"hashicorp/terraform:1.9.5",
+				"plan", "-detailed-exitcode", "-out=/tmp/terracotta-plan-1/network/tfplan",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.dockerArgs(tt.inv, "terracotta-test")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("dockerArgs() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDockerRunnerKillsContainer(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh not available")
+	}
+	saved := killDelay
+	defer func() { killDelay = saved }()
+	killDelay = 100 * time.Millisecond
+
+	// The fake docker client ignores interrupts and records the arguments
+	// of docker run and docker kill.
+	dir := t.TempDir()
+	docker := filepath.Join(dir, "docker")
+	script := `#!/bin/sh
+case "$1" in
+run)
+  echo "$@" > "` + dir + `/run"
+  trap '' INT
+  echo "started"
+  while true; do sleep 0.01; done
+  ;;
+kill)
+  echo "$@" >> "` + dir + `/kill"
+  ;;
+esac
+`
+	if err := os.WriteFile(docker, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to create fake docker: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		killAll bool
+	}{
+		{name: "after the deadline", timeout: 100 * time.Millisecond},
+		{name: "by KillAll", killAll: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = os.Remove(filepath.Join(dir, "kill"))
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.timeout > 0 {
+				ctx, cancel = context.WithTimeout(context.Background(), tt.timeout)
+			}
+			defer cancel()
+
+			d := DockerRunner{Image: "hashicorp/terraform", Docker: docker, Root: t.TempDir()}
+			n := &lineNotifier{text: "[mod] started", seen: make(chan struct{})}
+			go func() {
+				<-n.seen
+				if tt.killAll {
+					KillAll()
+				}
+			}()
+
+			done := make(chan error)
+			go func() {
+				_, err := Stream(ctx, d, n, "mod", Invocation{Dir: d.Root, Args: []string{"apply"}})
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Error("expected an error after the client was killed")
+				}
+			case <-time.After(5 * time.Second):
+				KillAll()
+				t.Fatal("the docker client was not killed")
+			}
+
+			run, err := os.ReadFile(filepath.Join(dir, "run"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields := strings.Fields(string(run))
+			if len(fields) < 4 || fields[2] != "--name" {
+				t.Fatalf("expected the container to be named, got docker %s", run)
+			}
+			kill, err := os.ReadFile(filepath.Join(dir, "kill"))
+			if err != nil {
+				t.Fatalf("expected the container to be killed: %v", err)
+			}
+			if want := "kill " + fields[3] + "\n"; string(kill) != want {
+				t.Errorf("expected docker %q, got %q", want, kill)
+			}
+		})
+	}
+}
@@ -1,26 +1,116 @@
 package terraform
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"os/exec"
+	"io"
+	"os"
+	"sync"
 )
 
+// RunCommand runs terraform in modulePath with ExecRunner and streams its
+// output to stdout like Stream.
 func RunCommand(prefix string, modulePath string, args ...string) error {
-	cmd := exec.Command("terraform", args...)
-	cmd.Dir = modulePath
+	_, err := Stream(context.Background(), ExecRunner{}, os.Stdout, prefix, Invocation{Dir: modulePath, Args: args})
+	return err
+}
+
+// Stream runs inv with r and streams its output to w line by line while it
+// runs, each line prefixed with "[prefix] ". Lines from standard error are
+// marked with "! " after the prefix. It returns the unprefixed output of
+// both streams in the order it was written. The Stdout and Stderr of inv
+// are ignored.
+func Stream(ctx context.Context, r Runner, w io.Writer, prefix string, inv Invocation) ([]byte, error) {
+	fmt.Fprintf(w, "[%s] Running: %s %v\n", prefix, inv.command(), inv.Args)
+
+	var mu sync.Mutex
+	var output bytes.Buffer
+	stdout := &lineWriter{mu: &mu, w: w, prefix: "[" + prefix + "] ", output: &output}
+	stderr := &lineWriter{mu: &mu, w: w, prefix: "[" + prefix + "] ! ", output: &output}
+	inv.Stdout = stdout
+	inv.Stderr = stderr
+
+	err := r.Run(ctx, inv)
+	stdout.Flush()
+	stderr.Flush()
+	return output.Bytes(), err
+}
 
-	fmt.Printf("[%s] Running: terraform %v\n", prefix, args)
+// lineWriter writes everything written to it to w one complete line at a
+// time, each with prefix, and keeps a copy in output. Blank lines are
+// dropped. Writers sharing mu never interleave within a line.
+type lineWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	output *bytes.Buffer
+	buf    []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	output, err := cmd.CombinedOutput()
-	scanner := bufio.NewScanner(bytes.NewReader(output))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line != "" {
-			fmt.Printf("[%s] %s\n", prefix, line)
+	l.output.Write(p)
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
 		}
+		l.writeLine(l.buf[:i])
+		l.buf = l.buf[i+1:]
 	}
+	return len(p), nil
+}
 
-	return err
+// Flush writes a final line that has no newline.
+func (l *lineWriter) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buf) > 0 {
+		l.writeLine(l.buf)
+		l.buf = nil
+	}
+}
+
+func (l *lineWriter) writeLine(line []byte) {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if len(line) == 0 {
+		return
+	}
+	fmt.Fprintf(l.w, "%s%s\n", l.prefix, line)
+}
+
+// Collect runs inv with r and returns its standard output without printing
+// it. Standard error is included in the returned error.
+func Collect(ctx context.Context, r Runner, inv Invocation) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	inv.Stdout = &stdout
+	inv.Stderr = &stderr
+
+	if err := r.Run(ctx, inv); err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return stdout.Bytes(), fmt.Errorf("%w: %s", err, msg)
+		}
+		return stdout.Bytes(), err
+	}
+	return stdout.Bytes(), nil
+}
+
+// PlanChanges interprets the error returned by a terraform plan run with
+// -detailed-exitcode. Exit status 2 means the plan succeeded and has
+// changes, so it is reported as changes rather than an error.
+func PlanChanges(err error) (bool, error) {
+	if err == nil {
+		return false, nil
+	}
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+		return true, nil
+	}
+	return false, err
 }
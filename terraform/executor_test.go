@@ -1,11 +1,16 @@
 package terraform
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestRunCommand(t *testing.T) {
@@ -155,3 +160,212 @@ echo "Line 3"
 		}
 	}
 }
+
+func TestPlanChanges(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh not available")
+	}
+
+	exitWith := func(code string) error {
+		return exec.Command("/bin/sh", "-c", "exit "+code).Run()
+	}
+
+	tests := []struct {
+		name        string
+		err         error
+		wantChanges bool
+		wantError   bool
+	}{
+		{name: "no changes", err: nil, wantChanges: false, wantError: false},
+		{name: "changes", err: exitWith("2"), wantChanges: true, wantError: false},
+		{name: "error", err: exitWith("1"), wantChanges: false, wantError: true},
+		{name: "not an exit error", err: os.ErrNotExist, wantChanges: false, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := PlanChanges(tt.err)
+			if changes != tt.wantChanges {
+				t.Errorf("expected changes=%v, got %v", tt.wantChanges, changes)
+			}
+			if (err != nil) != tt.wantError {
+				t.Errorf("expected error=%v, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+// fakeTerraform puts a terraform shell script with the given body first in
+// PATH for the rest of the test.
+func fakeTerraform(t *testing.T, body string) {
+	t.Helper()
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh not available")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" + body
+	if err := os.WriteFile(filepath.Join(dir, "terraform"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to create fake terraform: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestStreamMarksStderr(t *testing.T) {
+	fakeTerraform(t, `echo "out 1"
+echo "err 1" >&2
+echo
+printf "out 2"
+exit 1
+`)
+
+	var buf bytes.Buffer
+	output, err := Stream(context.Background(), ExecRunner{}, &buf, "mod", Invocation{Dir: t.TempDir(), Args: []string{"plan"}})
+	if err == nil {
+		t.Error("expected the exit status to be returned as an error")
+	}
+
+	for _, want := range []string{"[mod] Running: terraform [plan]\n", "[mod] out 1\n", "[mod] ! err 1\n", "[mod] out 2\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "[mod] \n") {
+		t.Errorf("expected blank lines to be dropped, got:\n%s", buf.String())
+	}
+	for _, want := range []string{"out 1\n", "err 1\n", "out 2"} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("expected captured output to contain %q, got %q", want, output)
+		}
+	}
+}
+
+// lineNotifier signals on seen the first time a line containing text is
+// written.
+type lineNotifier struct {
+	text string
+	seen chan struct{}
+	once sync.Once
+}
+
+func (n *lineNotifier) Write(p []byte) (int, error) {
+	if strings.Contains(string(p), n.text) {
+		n.once.Do(func() { close(n.seen) })
+	}
+	return len(p), nil
+}
+
+func TestStreamStreams(t *testing.T) {
+	// The fake terraform prints a line and then waits for a file that the
+	// test only creates once it has seen that line, so the test fails if
+	// output is held back until the process exits.
+	release := filepath.Join(t.TempDir(), "release")
+	fakeTerraform(t, `echo "started"
+i=0
+while [ ! -f "`+release+`" ]; do
+  i=$((i+1))
+  if [ $i -gt 500 ]; then exit 3; fi
+  sleep 0.01
+done
+echo "finished"
+`)
+
+	n := &lineNotifier{text: "[mod] started", seen: make(chan struct{})}
+	go func() {
+		<-n.seen
+		_ = os.WriteFile(release, nil, 0644)
+	}()
+
+	output, err := Stream(context.Background(), ExecRunner{}, n, "mod", Invocation{Dir: t.TempDir(), Args: []string{"apply"}})
+	if err != nil {
+		t.Fatalf("expected the output to be streamed before terraform exited, got %v", err)
+	}
+	if string(output) != "started\nfinished\n" {
+		t.Errorf("unexpected captured output %q", output)
+	}
+}
+
+func TestStreamInterruptsOnCancel(t *testing.T) {
+	fakeTerraform(t, `trap 'echo "caught interrupt"; exit 1' INT
+echo "started"
+while true; do sleep 0.01; done
+`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &lineNotifier{text: "[mod] started", seen: make(chan struct{})}
+	go func() {
+		<-n.seen
+		cancel()
+	}()
+
+	output, err := Stream(ctx, ExecRunner{}, n, "mod", Invocation{Dir: t.TempDir(), Args: []string{"apply"}})
+	if err == nil {
+		t.Error("expected an error after the interrupt")
+	}
+	if !strings.Contains(string(output), "caught interrupt") {
+		t.Errorf("expected terraform to receive an interrupt, got output %q", output)
+	}
+}
+
+func TestKillAll(t *testing.T) {
+	fakeTerraform(t, `trap '' INT
+echo "started"
+while true; do sleep 0.01; done
+`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &lineNotifier{text: "[mod] started", seen: make(chan struct{})}
+	go func() {
+		<-n.seen
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+		KillAll()
+	}()
+
+	done := make(chan error)
+	go func() {
+		_, err := Stream(ctx, ExecRunner{}, n, "mod", Invocation{Dir: t.TempDir(), Args: []string{"apply"}})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected an error after the process was killed")
+		}
+	case <-time.After(5 * time.Second):
+		KillAll()
+		t.Fatal("terraform ignoring the interrupt was not killed")
+	}
+}
+
+func TestStreamKillsAfterDeadline(t *testing.T) {
+	fakeTerraform(t, `trap 'echo "ignoring interrupt"' INT
+while true; do sleep 0.01; done
+`)
+	saved := killDelay
+	defer func() { killDelay = saved }()
+	killDelay = 100 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	var output []byte
+	var err error
+	go func() {
+		output, err = Stream(ctx, ExecRunner{}, io.Discard, "mod", Invocation{Dir: t.TempDir(), Args: []string{"apply"}})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		KillAll()
+		t.Fatal("terraform was not killed after the deadline")
+	}
+
+	if err == nil {
+		t.Error("expected an error after the deadline")
+	}
+	if !strings.Contains(string(output), "ignoring interrupt") {
+		t.Errorf("expected an interrupt before the kill, got output %q", output)
+	}
+}
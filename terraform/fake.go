@@ -0,0 +1,135 @@
+package terraform
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeRunner is a Runner for tests that starts no process. It records every
+// invocation and answers it with the first scripted response that matches,
+// or with Default if none does. It is safe for concurrent use.
+type FakeRunner struct {
+	// Default answers invocations no scripted response matches. Its zero
+	// value succeeds without output.
+	Default FakeResponse
+
+	mu    sync.Mutex
+	rules []*fakeRule
+	calls []FakeCall
+}
+
+// FakeCall is an invocation recorded by a FakeRunner.
+type FakeCall struct {
+	Command string
+	Dir     string
+	Args    []string
+	Env     []string
+}
+
+// Step returns the terraform subcommand of the call, such as "plan".
+func (c FakeCall) Step() string {
+	if len(c.Args) == 0 {
+		return ""
+	}
+	return c.Args[0]
+}
+
+// FakeResponse is what a FakeRunner writes and returns for an invocation.
+type FakeResponse struct {
+	Stdout string
+	Stderr string
+	// ExitCode makes the invocation fail with an *ExitError.
+	ExitCode int
+	// Err is returned as is, e.g. to simulate a missing binary. It takes
+	// precedence over ExitCode.
+	Err error
+	// Delay makes the invocation take this long. If ctx is cancelled first,
+	// the invocation fails with exit status 1, as terraform does when it is
+	// interrupted.
+	Delay time.Duration
+	// Times limits how many invocations the response answers. Zero means
+	// no limit.
+	Times int
+}
+
+type fakeRule struct {
+	dir  string
+	step string
+	resp FakeResponse
+	used int
+}
+
+// On scripts resp for invocations of step, such as "apply", in a directory
+// that is dir or ends with dir as its last path elements. An empty dir or
+// step matches any. Responses are tried in the order they were added.
+func (f *FakeRunner) On(dir, step string, resp FakeResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, &fakeRule{dir: filepath.ToSlash(dir), step: step, resp: resp})
+}
+
+// Calls returns the invocations so far, in the order they were made.
+func (f *FakeRunner) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+func (f *FakeRunner) Run(ctx context.Context, inv Invocation) error {
+	call := FakeCall{
+		Command: inv.command(),
+		Dir:     inv.Dir,
+		Args:    slices.Clone(inv.Args),
+		Env:     slices.Clone(inv.Env),
+	}
+	resp := f.respond(call)
+
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-ctx.Done():
+			return &ExitError{Code: 1}
+		}
+	}
+	if resp.Stdout != "" && inv.Stdout != nil {
+		_, _ = io.WriteString(inv.Stdout, resp.Stdout)
+	}
+	if resp.Stderr != "" && inv.Stderr != nil {
+		_, _ = io.WriteString(inv.Stderr, resp.Stderr)
+	}
+	switch {
+	case resp.Err != nil:
+		return resp.Err
+	case resp.ExitCode != 0:
+		return &ExitError{Code: resp.ExitCode}
+	}
+	return nil
+}
+
+// respond records call and picks its response.
+func (f *FakeRunner) respond(call FakeCall) FakeResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, call)
+	dir := filepath.ToSlash(call.Dir)
+	for _, r := range f.rules {
+		if r.step != "" && r.step != call.Step() {
+			continue
+		}
+		if r.dir != "" && dir != r.dir && !strings.HasSuffix(dir, "/"+r.dir) {
+			continue
+		}
+		if r.resp.Times > 0 && r.used >= r.resp.Times {
+			continue
+		}
+		r.used++
+		return r.resp
+	}
+	return f.Default
+}
@@ -0,0 +1,82 @@
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFakeRunner(t *testing.T) {
+	f := &FakeRunner{}
+	f.On("app", "apply", FakeResponse{Stderr: "Error acquiring the state lock\n", ExitCode: 1, Times: 1})
+	f.On("app", "apply", FakeResponse{Stdout: "Apply complete!\n"})
+	f.On("", "plan", FakeResponse{ExitCode: 2})
+
+	var out bytes.Buffer
+	ctx := context.Background()
+	if _, err := Stream(ctx, f, &out, "app", Invocation{Dir: "envs/dev/app", Args: []string{"apply"}}); err == nil {
+		t.Error("expected the first apply to fail")
+	}
+	output, err := Stream(ctx, f, &out, "app", Invocation{Dir: "envs/dev/app", Args: []string{"apply"}})
+	if err != nil {
+		t.Errorf("expected the second apply to succeed, got %v", err)
+	}
+	if string(output) != "Apply complete!\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+	if _, err := Stream(ctx, f, &out, "web", Invocation{Dir: "envs/dev/web", Args: []string{"apply"}}); err != nil {
+		t.Errorf("expected the default response for web, got %v", err)
+	}
+	changes, err := PlanChanges(f.Run(ctx, Invocation{Dir: "envs/dev/web", Args: []string{"plan"}}))
+	if !changes || err != nil {
+		t.Errorf("expected exit status 2 to mean changes, got %v, %v", changes, err)
+	}
+
+	want := "[app] Running: terraform [apply]\n" +
+		"[app] ! Error acquiring the state lock\n" +
+		"[app] Running: terraform [apply]\n" +
+		"[app] Apply complete!\n" +
+		"[web] Running: terraform [apply]\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("output mismatch (-want +got):\n%s", diff)
+	}
+
+	var steps []string
+	for _, c := range f.Calls() {
+		steps = append(steps, c.Dir+" "+c.Step())
+	}
+	wantSteps := []string{"envs/dev/app apply", "envs/dev/app apply", "envs/dev/web apply", "envs/dev/web plan"}
+	if diff := cmp.Diff(wantSteps, steps); diff != "" {
+		t.Errorf("calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFakeRunnerCancel(t *testing.T) {
+	f := &FakeRunner{Default: FakeResponse{Delay: time.Minute}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var exitErr *ExitError
+	if err := f.Run(ctx, Invocation{Args: []string{"apply"}}); !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Errorf("expected exit status 1 after cancel, got %v", err)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	f := &FakeRunner{}
+	f.On("", "show", FakeResponse{Stdout: `{"format_version": "1.2"}`})
+	f.On("", "output", FakeResponse{Stdout: "partial", Stderr: "Error: no state\n", ExitCode: 1})
+
+	got, err := Collect(context.Background(), f, Invocation{Args: []string{"show", "-json"}})
+	if err != nil || string(got) != `{"format_version": "1.2"}` {
+		t.Errorf("unexpected result %q, %v", got, err)
+	}
+	_, err = Collect(context.Background(), f, Invocation{Args: []string{"output"}})
+	if err == nil || err.Error() != "exit status 1: Error: no state" {
+		t.Errorf("expected stderr in the error, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Resource change actions, as grouped by ResourceChanges.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionReplace = "replace"
+	ActionDelete  = "delete"
+)
+
+// ResourceChanges summarizes the resource changes in a plan. Replaced
+// resources count as both an addition and a destruction, as in terraform's
+// own "Plan:" line.
+type ResourceChanges struct {
+	Add     int `json:"add"`
+	Change  int `json:"change"`
+	Destroy int `json:"destroy"`
+	// Addresses lists the changed resource addresses by action.
+	Addresses map[string][]string `json:"addresses,omitempty"`
+}
+
+// String formats the counts as "+3 ~1 -2".
+func (c ResourceChanges) String() string {
+	return fmt.Sprintf("+%d ~%d -%d", c.Add, c.Change, c.Destroy)
+}
+
+// Plus returns the sum of c and other, without addresses.
+func (c ResourceChanges) Plus(other ResourceChanges) ResourceChanges {
+	return ResourceChanges{
+		Add:     c.Add + other.Add,
+		Change:  c.Change + other.Change,
+		Destroy: c.Destroy + other.Destroy,
+	}
+}
+
+// planJSON is the part of the `terraform show -json` plan format that
+// ResourceChanges needs.
+type planJSON struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Change  struct {
+			Actions []string `json:"actions"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// ParsePlanJSON reads the output of `terraform show -json <planfile>` and
+// counts the resource changes it contains.
+func ParsePlanJSON(data []byte) (*ResourceChanges, error) {
+	var plan planJSON
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan JSON: %w", err)
+	}
+
+	changes := &ResourceChanges{Addresses: map[string][]string{}}
+	for _, rc := range plan.ResourceChanges {
+		var action string
+		switch actions := rc.Change.Actions; {
+		case len(actions) == 2:
+			// ["delete", "create"] or ["create", "delete"]
+			action = ActionReplace
+			changes.Add++
+			changes.Destroy++
+		case len(actions) == 1 && actions[0] == "create":
+			action = ActionCreate
+			changes.Add++
+		case len(actions) == 1 && actions[0] == "update":
+			action = ActionUpdate
+			changes.Change++
+		case len(actions) == 1 && actions[0] == "delete":
+			action = ActionDelete
+			changes.Destroy++
+		default:
+			// no-op, read and forget do not change infrastructure.
+			continue
+		}
+		changes.Addresses[action] = append(changes.Addresses[action], rc.Address)
+	}
+	return changes, nil
+}
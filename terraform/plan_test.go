@@ -0,0 +1,69 @@
+package terraform
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePlanJSON(t *testing.T) {
+	data := []byte(`{
+  "format_version": "1.2",
+  "resource_changes": [
+    {"address": "aws_vpc.main", "change": {"actions": ["no-op"]}},
+    {"address": "aws_subnet.a", "change": {"actions": ["create"]}},
+    {"address": "aws_subnet.b", "change": {"actions": ["create"]}},
+    {"address": "aws_instance.web", "change": {"actions": ["update"]}},
+    {"address": "aws_instance.db", "change": {"actions": ["delete", "create"]}},
+    {"address": "aws_instance.old", "change": {"actions": ["delete"]}},
+    {"address": "data.aws_ami.ubuntu", "change": {"actions": ["read"]}}
+  ]
+}`)
+
+	got, err := ParsePlanJSON(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := &ResourceChanges{
+		Add:     3,
+		Change:  1,
+		Destroy: 2,
+		Addresses: map[string][]string{
+			ActionCreate:  {"aws_subnet.a", "aws_subnet.b"},
+			ActionUpdate:  {"aws_instance.web"},
+			ActionReplace: {"aws_instance.db"},
+			ActionDelete:  {"aws_instance.old"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParsePlanJSON() mismatch (-want +got):\n%s", diff)
+	}
+	if got.String() != "+3 ~1 -2" {
+		t.Errorf("expected +3 ~1 -2, got %s", got.String())
+	}
+}
+
+func TestParsePlanJSONNoChanges(t *testing.T) {
+	got, err := ParsePlanJSON([]byte(`{"format_version": "1.2"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.String() != "+0 ~0 -0" {
+		t.Errorf("expected +0 ~0 -0, got %s", got.String())
+	}
+}
+
+func TestParsePlanJSONInvalid(t *testing.T) {
+	if _, err := ParsePlanJSON([]byte("Error: no plan")); err == nil {
+		t.Error("expected error for invalid JSON but got none")
+	}
+}
+
+func TestResourceChangesPlus(t *testing.T) {
+	a := ResourceChanges{Add: 1, Change: 2, Destroy: 3}
+	b := ResourceChanges{Add: 4, Change: 0, Destroy: 1}
+	if got := a.Plus(b).String(); got != "+5 ~2 -4" {
+		t.Errorf("expected +5 ~2 -4, got %s", got)
+	}
+}
@@ -0,0 +1,89 @@
+package terraform
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// running holds the terraform processes that have been started and not yet
+// waited for, and the containers started by DockerRunner by name with the
+// docker client that started them, so that KillAll can reach them.
+var running = struct {
+	sync.Mutex
+	procs      map[*os.Process]bool
+	containers map[string]string
+}{procs: map[*os.Process]bool{}, containers: map[string]string{}}
+
+// killDelay is how long terraform may take to stop after an interrupt
+// caused by a deadline before it is killed.
+var killDelay = 30 * time.Second
+
+// command returns a command running name in modulePath that is interrupted
+// rather than killed when ctx is cancelled. Terraform runs in its own
+// process group, so a Ctrl-C in the terminal reaches terracotta only and
+// terraform sees exactly the interrupts terracotta passes on.
+func command(ctx context.Context, name, modulePath string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = modulePath
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return interruptProcess(cmd.Process)
+	}
+	return cmd
+}
+
+// run starts cmd and waits for it, keeping track of it while it runs. If
+// ctx passes its deadline, cmd is interrupted and then killed if it is still
+// running after killDelay.
+func run(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	delay := killDelay
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return
+		}
+		select {
+		case <-time.After(delay):
+			_ = killProcess(cmd.Process)
+		case <-done:
+		}
+	}()
+
+	running.Lock()
+	running.procs[cmd.Process] = true
+	running.Unlock()
+	defer func() {
+		running.Lock()
+		delete(running.procs, cmd.Process)
+		running.Unlock()
+	}()
+
+	return cmd.Wait()
+}
+
+// KillAll kills every terraform process that is still running, together
+// with its provider plugins, and every container running terraform.
+func KillAll() {
+	running.Lock()
+	defer running.Unlock()
+	for p := range running.procs {
+		_ = killProcess(p)
+	}
+	for name, docker := range running.containers {
+		killContainer(docker, name)
+	}
+}
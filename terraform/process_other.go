@@ -0,0 +1,21 @@
+//go:build !unix
+
+package terraform
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func interruptProcess(p *os.Process) error {
+	if err := p.Signal(os.Interrupt); err != nil {
+		return p.Kill()
+	}
+	return nil
+}
+
+func killProcess(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,70 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Invocation describes one run of terraform.
+type Invocation struct {
+	// Command is the binary to run. It defaults to terraform.
+	Command string
+	// Dir is the directory terraform runs in.
+	Dir  string
+	Args []string
+	// Env holds variables in "KEY=value" form that are added to the
+	// environment of terracotta.
+	Env []string
+	// Stdout and Stderr receive the output of terraform. A nil writer
+	// discards it.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func (inv Invocation) command() string {
+	if inv.Command == "" {
+		return "terraform"
+	}
+	return inv.Command
+}
+
+// Runner runs terraform. A Runner returns an error with an ExitCode method,
+// such as *exec.ExitError or *ExitError, when terraform exits with a
+// non-zero status.
+type Runner interface {
+	Run(ctx context.Context, inv Invocation) error
+}
+
+// ExecRunner runs terraform as a child process.
+//
+// When ctx is cancelled terraform is sent an interrupt, so that it can stop
+// cleanly and release its state lock, and Run waits for it to exit. KillAll
+// stops it immediately. When ctx passes its deadline, terraform is killed if
+// it has not stopped within 30 seconds of the interrupt.
+type ExecRunner struct{}
+
+func (ExecRunner) Run(ctx context.Context, inv Invocation) error {
+	cmd := command(ctx, inv.command(), inv.Dir, inv.Args...)
+	if len(inv.Env) > 0 {
+		cmd.Env = append(os.Environ(), inv.Env...)
+	}
+	cmd.Stdout = inv.Stdout
+	cmd.Stderr = inv.Stderr
+	return run(ctx, cmd)
+}
+
+// ExitError reports that terraform exited with a non-zero status. It is
+// returned by runners that do not start a process.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}